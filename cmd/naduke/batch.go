@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/takai/naduke/internal/naduke"
+)
+
+// batchNamer names several files in one request, for -batch.
+type batchNamer interface {
+	suggester
+	SuggestNames(opts naduke.Options, files []naduke.BatchFile) ([]string, error)
+}
+
+// batch is one -batch request, sent once by whichever worker first needs
+// one of its names.
+type batch struct {
+	files []naduke.BatchFile
+	once  sync.Once
+	names []string
+	err   error
+}
+
+// batchSuggester answers SuggestName from batched requests for the files
+// PlanBatches grouped, and asks per file for the rest or when a batch answer
+// is unusable.
+type batchSuggester struct {
+	namer   batchNamer
+	batches map[string]*batch
+	index   map[string]int
+}
+
+// newBatchSuggester reads the samples of files and plans the batches.
+// Duplicates and files that cannot be read are left to the per-file path,
+// which reports their errors.
+func newBatchSuggester(namer batchNamer, opts naduke.Options, files []string) *batchSuggester {
+	var candidates []naduke.BatchFile
+	for _, path := range files {
+		if _, ok := opts.DuplicateOf[path]; ok {
+			continue
+		}
+		text, err := readText(opts, path)
+		if err != nil || text == "" {
+			continue
+		}
+		candidates = append(candidates, naduke.BatchFile{Path: path, Content: text})
+	}
+
+	s := &batchSuggester{namer: namer, batches: map[string]*batch{}, index: map[string]int{}}
+	for _, files := range naduke.PlanBatches(candidates, opts) {
+		b := &batch{files: files}
+		for i, file := range files {
+			s.batches[file.Path] = b
+			s.index[file.Path] = i
+		}
+	}
+	return s
+}
+
+func (s *batchSuggester) SuggestName(opts naduke.Options, path, content string) (string, error) {
+	b, ok := s.batches[path]
+	if !ok {
+		return s.namer.SuggestName(opts, path, content)
+	}
+	b.once.Do(func() {
+		b.names, b.err = s.namer.SuggestNames(opts, b.files)
+	})
+	if b.err != nil {
+		slog.Debug("batch failed, naming file on its own", "path", path, "error", b.err)
+		return s.namer.SuggestName(opts, path, content)
+	}
+	name := b.names[s.index[path]]
+	if _, err := naduke.ValidateFor(opts, name); err != nil {
+		slog.Debug("invalid batch answer, naming file on its own", "path", path, "error", err)
+		return s.namer.SuggestName(opts, path, content)
+	}
+	return name, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// batchOllama answers batch prompts with batchAnswer and single-file prompts
+// with "single_name", counting both.
+func batchOllama(t *testing.T, batchAnswer string) (*httptest.Server, func() (int, int)) {
+	t.Helper()
+	var mu sync.Mutex
+	batches, singles := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Messages []struct{ Content string } `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		answer := "single_name"
+		mu.Lock()
+		if strings.Contains(payload.Messages[0].Content, "several files") {
+			batches++
+			answer = batchAnswer
+		} else {
+			singles++
+		}
+		mu.Unlock()
+		body, _ := json.Marshal(map[string]any{"message": map[string]string{"role": "assistant", "content": answer}})
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return batches, singles
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		files = append(files, writeFile(t, dir, name, []byte("notes "+name)))
+	}
+
+	server, counts := batchOllama(t, `["alpha_notes", "beta_notes", "gamma_notes"]`)
+	var stdout, stderr bytes.Buffer
+	args := append([]string{"-server", server.URL, "-dry-run", "-jobs", "3", "-batch", "5"}, files...)
+	if code := run(args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+	want := files[0] + " -> " + filepath.Join(dir, "alpha_notes.txt") + "\n" +
+		files[1] + " -> " + filepath.Join(dir, "beta_notes.txt") + "\n" +
+		files[2] + " -> " + filepath.Join(dir, "gamma_notes.txt") + "\n"
+	if stdout.String() != want {
+		t.Fatalf("unexpected output: %q; want %q", stdout.String(), want)
+	}
+	if batches, singles := counts(); batches != 1 || singles != 0 {
+		t.Fatalf("expected one batch request, got %d batch and %d single", batches, singles)
+	}
+
+	// A wrong count falls back to one request per file.
+	server, counts = batchOllama(t, `["alpha_notes"]`)
+	stdout.Reset()
+	args[1] = server.URL
+	if code := run(args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+	if batches, singles := counts(); batches != 1 || singles != 3 {
+		t.Fatalf("expected a per-file fallback, got %d batch and %d single", batches, singles)
+	}
+}
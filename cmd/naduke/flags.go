@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/takai/naduke/internal/naduke"
+)
+
+// extRewriteFlag collects repeatable -rewrite-ext old=new mappings.
+type extRewriteFlag map[string]string
+
+func (f extRewriteFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for from, to := range f {
+		pairs = append(pairs, from+"="+to)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f extRewriteFlag) Set(value string) error {
+	from, to, ok := strings.Cut(value, "=")
+	from, to = naduke.NormalizeExt(from), strings.TrimSpace(to)
+	if !ok || from == "" || to == "" {
+		return fmt.Errorf("expected old=new, got %q", value)
+	}
+	if !strings.HasPrefix(to, ".") {
+		to = "." + to
+	}
+	f[from] = to
+	return nil
+}
+
+// modelForFlag collects repeatable -model-for ext=model mappings.
+type modelForFlag map[string]string
+
+func (f modelForFlag) String() string {
+	return extRewriteFlag(f).String()
+}
+
+func (f modelForFlag) Set(value string) error {
+	ext, model, ok := strings.Cut(value, "=")
+	ext, model = naduke.NormalizeExt(ext), strings.TrimSpace(model)
+	if !ok || ext == "" || model == "" {
+		return fmt.Errorf("expected ext=model, got %q", value)
+	}
+	f[ext] = model
+	return nil
+}
+
+// hostConcurrencyFlag collects repeatable -host-concurrency host=N limits.
+type hostConcurrencyFlag map[string]int
+
+func (f hostConcurrencyFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for host, n := range f {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", host, n))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f hostConcurrencyFlag) Set(value string) error {
+	host, limit, ok := strings.Cut(value, "=")
+	host = strings.ToLower(strings.TrimSpace(host))
+	n, err := strconv.Atoi(strings.TrimSpace(limit))
+	if !ok || host == "" || err != nil || n < 1 {
+		return fmt.Errorf("expected host=N with N at least 1, got %q", value)
+	}
+	f[host] = n
+	return nil
+}
+
+// extListFlag collects repeatable -ext extensions.
+type extListFlag map[string]bool
+
+func (f extListFlag) String() string {
+	exts := make([]string, 0, len(f))
+	for ext := range f {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return strings.Join(exts, ",")
+}
+
+func (f extListFlag) Set(value string) error {
+	ext := naduke.NormalizeExt(value)
+	if ext == "" || ext == "." {
+		return fmt.Errorf("expected an extension such as .txt, got %q", value)
+	}
+	f[ext] = true
+	return nil
+}
+
+// stringListFlag collects repeatable text values such as -retry-prompt.
+type stringListFlag struct {
+	values *[]string
+}
+
+func (f stringListFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	return strings.Join(*f.values, ",")
+}
+
+func (f stringListFlag) Set(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("value must not be empty")
+	}
+	*f.values = append(*f.values, value)
+	return nil
+}
+
+// regexpListFlag collects repeatable -prefilter patterns, compiling each as
+// it is given so a bad pattern fails at startup.
+type regexpListFlag struct {
+	patterns *[]*regexp.Regexp
+}
+
+func (f regexpListFlag) String() string {
+	if f.patterns == nil {
+		return ""
+	}
+	exprs := make([]string, len(*f.patterns))
+	for i, pattern := range *f.patterns {
+		exprs[i] = pattern.String()
+	}
+	return strings.Join(exprs, ",")
+}
+
+func (f regexpListFlag) Set(value string) error {
+	pattern, err := regexp.Compile(value)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	*f.patterns = append(*f.patterns, pattern)
+	return nil
+}
+
+// applyConfig sets the flags named in the config file at path, with the
+// settings of profile on top, unless they were given on the command line. An
+// empty path reads the default config file if there is one.
+func applyConfig(fs *flag.FlagSet, path, profile string) error {
+	explicit := path != ""
+	if !explicit {
+		path = naduke.DefaultConfigPath()
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			if profile != "" {
+				return fmt.Errorf("-profile %s needs a config file: %s does not exist", profile, path)
+			}
+			return nil
+		}
+		return fmt.Errorf("open config: %w", err)
+	}
+	defer f.Close()
+	config, err := naduke.ParseConfig(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	settings, err := config.Profile(profile)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == "config" || key == "profile" {
+			return fmt.Errorf("%s: %s cannot be set in a config file", path, key)
+		}
+		if fs.Lookup(key) == nil {
+			return fmt.Errorf("%s: unknown setting %q (want a flag name)", path, key)
+		}
+		if set[key] {
+			continue
+		}
+		for _, value := range settings[key] {
+			if err := fs.Set(key, value); err != nil {
+				return fmt.Errorf("%s: %s: %w", path, key, err)
+			}
+		}
+	}
+	return nil
+}
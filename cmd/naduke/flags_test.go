@@ -0,0 +1,219 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/takai/naduke/internal/naduke"
+)
+
+func TestParseArgsRewriteExt(t *testing.T) {
+	t.Parallel()
+
+	opts, _, _, _, err := parseArgs([]string{"-rewrite-ext", "txt=json", "-rewrite-ext", ".LOG=.csv", "file.txt"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{".txt": ".json", ".log": ".csv"}
+	if len(opts.ExtRewrites) != len(want) {
+		t.Fatalf("unexpected rewrites: %v", opts.ExtRewrites)
+	}
+	for from, to := range want {
+		if opts.ExtRewrites[from] != to {
+			t.Fatalf("rewrite %s = %q; want %q", from, opts.ExtRewrites[from], to)
+		}
+	}
+
+	for _, bad := range []string{"txt", "=json", "txt="} {
+		if _, _, _, _, err := parseArgs([]string{"-rewrite-ext", bad, "file.txt"}); err == nil {
+			t.Fatalf("expected error for -rewrite-ext %q", bad)
+		}
+	}
+}
+
+func TestParseArgsModelFor(t *testing.T) {
+	t.Parallel()
+
+	opts, _, _, _, err := parseArgs([]string{"-model-for", "go=coder", "-model-for", ".MD=writer", "file.go"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.ModelForExt[".go"] != "coder" || opts.ModelForExt[".md"] != "writer" {
+		t.Fatalf("unexpected mapping: %v", opts.ModelForExt)
+	}
+
+	for _, bad := range []string{"go", "=coder", "go="} {
+		if _, _, _, _, err := parseArgs([]string{"-model-for", bad, "file.go"}); err == nil {
+			t.Fatalf("expected error for -model-for %q", bad)
+		}
+	}
+}
+
+func TestParseArgsExt(t *testing.T) {
+	t.Parallel()
+
+	opts, _, _, _, err := parseArgs([]string{"-ext", ".TXT", "-ext", "md", "file.txt"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(opts.OnlyExts) != 2 || !opts.OnlyExts[".txt"] || !opts.OnlyExts[".md"] {
+		t.Fatalf("unexpected extensions: %v", opts.OnlyExts)
+	}
+
+	for _, bad := range []string{"", ".", " "} {
+		if _, _, _, _, err := parseArgs([]string{"-ext", bad, "file.txt"}); err == nil {
+			t.Fatalf("expected error for -ext %q", bad)
+		}
+	}
+}
+
+func TestParseArgsPrefilter(t *testing.T) {
+	t.Parallel()
+
+	opts, _, _, _, err := parseArgs([]string{"-prefilter", "^Sent from", "-prefilter", "(?i)confidential", "file.txt"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(opts.Prefilters) != 2 || opts.Prefilters[1].String() != "(?i)confidential" {
+		t.Fatalf("unexpected prefilters: %v", opts.Prefilters)
+	}
+	if _, _, _, _, err := parseArgs([]string{"-prefilter", "(unclosed", "file.txt"}); err == nil {
+		t.Fatalf("expected error for an invalid -prefilter pattern")
+	}
+}
+
+func TestParseArgsHostConcurrency(t *testing.T) {
+	t.Parallel()
+
+	opts, _, _, _, err := parseArgs([]string{"-host-concurrency", "weak:11434=2", "-host-concurrency", "Strong=8", "file.txt"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.HostConcurrency["weak:11434"] != 2 || opts.HostConcurrency["strong"] != 8 {
+		t.Fatalf("unexpected limits: %v", opts.HostConcurrency)
+	}
+
+	for _, bad := range []string{"weak", "=2", "weak=", "weak=0", "weak=x"} {
+		if _, _, _, _, err := parseArgs([]string{"-host-concurrency", bad, "file.txt"}); err == nil {
+			t.Fatalf("expected error for -host-concurrency %q", bad)
+		}
+	}
+}
+
+func TestParseArgsRetryPrompt(t *testing.T) {
+	t.Parallel()
+
+	opts, _, _, _, err := parseArgs([]string{"-retry-prompt", "Name this file:", "-retry-prompt", "Title?", "file.txt"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !opts.RotatePrompts || len(opts.RetryPrompts) != 2 || opts.RetryPrompts[1] != "Title?" {
+		t.Fatalf("unexpected prompts: %v %q", opts.RotatePrompts, opts.RetryPrompts)
+	}
+	if _, _, _, _, err := parseArgs([]string{"-retry-prompt", " ", "file.txt"}); err == nil {
+		t.Fatalf("expected error for an empty -retry-prompt")
+	}
+}
+
+func TestParseArgsConfigProfile(t *testing.T) {
+	t.Parallel()
+
+	config := writeFile(t, t.TempDir(), "config.toml", []byte(`
+style = "kebab"
+retries = 4
+
+[profiles.work]
+host = "ollama.corp.example"
+model = "qwen2.5:7b"
+prefilter = ['(?s)CONFIDENTIAL.*', "DRAFT"]
+
+[profiles.personal]
+style = "camel"
+`))
+
+	opts, _, _, _, err := parseArgs([]string{"-config", config, "-profile", "work", "-retries", "1", "file.txt"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Host != "ollama.corp.example" || opts.Model != "qwen2.5:7b" || len(opts.Prefilters) != 2 {
+		t.Fatalf("profile not applied: host %q, model %q, prefilters %v", opts.Host, opts.Model, opts.Prefilters)
+	}
+	if opts.Sanitizer.Sanitize("Meeting Notes") != "meeting-notes" {
+		t.Fatalf("top-level style not applied")
+	}
+	if opts.Retries != 1 {
+		t.Fatalf("command line should win over the config file: retries %d", opts.Retries)
+	}
+
+	opts, _, _, _, err = parseArgs([]string{"-config", config, "-profile", "personal", "file.txt"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Host != naduke.DefaultHost || opts.Model != naduke.DefaultModel || opts.Retries != 4 {
+		t.Fatalf("unset settings should fall back: host %q, model %q, retries %d", opts.Host, opts.Model, opts.Retries)
+	}
+	if opts.Sanitizer.Sanitize("Meeting Notes") != "meetingNotes" {
+		t.Fatalf("profile style should override the top-level one")
+	}
+
+	_, _, _, _, err = parseArgs([]string{"-config", config, "-profile", "home", "file.txt"})
+	if err == nil || !strings.Contains(err.Error(), "available: personal, work") {
+		t.Fatalf("expected unknown profile error listing profiles, got %v", err)
+	}
+
+	fallback := writeFile(t, t.TempDir(), "config.toml", []byte("model = \"llama3\"\n\n[profiles.work]\nmodels = \"qwen,llama\"\n"))
+	opts, _, _, _, err = parseArgs([]string{"-config", fallback, "-profile", "work", "file.txt"})
+	if err != nil {
+		t.Fatalf("profile models should override the config model: %v", err)
+	}
+	if opts.Model != "qwen" || len(opts.FallbackModels) != 1 || opts.FallbackModels[0] != "llama" {
+		t.Fatalf("models not applied: model %q, fallbacks %v", opts.Model, opts.FallbackModels)
+	}
+	opts, _, _, _, err = parseArgs([]string{"-config", fallback, "-profile", "work", "-model", "mistral", "file.txt"})
+	if err != nil || opts.Model != "mistral" || len(opts.FallbackModels) != 0 {
+		t.Fatalf("-model should override the profile models: model %q, fallbacks %v, err %v", opts.Model, opts.FallbackModels, err)
+	}
+	if _, _, _, _, err := parseArgs([]string{"-model", "a", "-models", "b,c", "file.txt"}); err == nil {
+		t.Fatalf("expected error for -model with -models on the command line")
+	}
+
+	bad := writeFile(t, t.TempDir(), "config.toml", []byte("colour = \"blue\"\n"))
+	if _, _, _, _, err := parseArgs([]string{"-config", bad, "file.txt"}); err == nil {
+		t.Fatalf("expected error for an unknown setting")
+	}
+}
+
+func TestParseArgsFlattenSeparators(t *testing.T) {
+	t.Parallel()
+
+	opts, _, _, _, err := parseArgs([]string{"-flatten-separators", "-style", "kebab", "file.txt"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.FlattenSeparators != "-" {
+		t.Fatalf("FlattenSeparators = %q; want -", opts.FlattenSeparators)
+	}
+	if _, _, _, _, err := parseArgs([]string{"-flatten-separators", "-style", "camel", "file.txt"}); err == nil {
+		t.Fatalf("expected error for -flatten-separators with -style camel")
+	}
+}
+
+func TestParseArgsHashAlgo(t *testing.T) {
+	t.Parallel()
+
+	opts, _, _, _, err := parseArgs([]string{"-hash-algo", "sha1", "-hash-length", "40", "file.txt"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.HashAlgorithm != naduke.HashSHA1 {
+		t.Fatalf("HashAlgorithm = %q; want sha1", opts.HashAlgorithm)
+	}
+	for _, args := range [][]string{
+		{"-hash-algo", "blake3", "file.txt"},
+		{"-hash-algo", "sha1", "-hash-length", "41", "file.txt"},
+	} {
+		if _, _, _, _, err := parseArgs(args); err == nil {
+			t.Fatalf("expected error for %v", args)
+		}
+	}
+}
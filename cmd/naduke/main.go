@@ -1,14 +1,39 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"regexp"
+	"runtime/debug"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/takai/naduke/internal/naduke"
 )
 
+// version is set at build time with -ldflags "-X main.version=v1.2.3".
+var version = ""
+
+// toolVersion returns version, or the module version recorded by go install,
+// or "devel" for a local build.
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "devel"
+}
+
 func usage(fs *flag.FlagSet) func() {
 	return func() {
 		fmt.Fprintf(fs.Output(), "Usage: %s [options] FILE...\n", fs.Name())
@@ -28,6 +53,20 @@ func parseArgs(args []string) (naduke.Options, []string, bool, *flag.FlagSet, er
 		DryRun:        false,
 		Prefix:        naduke.DefaultPrefix,
 		Dir:           naduke.DefaultDir,
+		Retries:       naduke.DefaultRetries,
+		TempStep:      naduke.DefaultTempStep,
+		MaxTemp:       naduke.DefaultMaxTemp,
+		HTTPRetries:   naduke.DefaultHTTPRetries,
+		EmptyRetries:  naduke.DefaultEmptyRetries,
+		Jobs:          naduke.DefaultJobs,
+		PromptProfile: naduke.DefaultPromptProfile,
+		OnCollision:   naduke.DefaultOnCollision,
+		OnAmbiguous:   naduke.DefaultOnAmbiguous,
+		OnModelError:  naduke.DefaultOnModelError,
+		OnFSError:     naduke.DefaultOnFSError,
+		HashLength:    naduke.DefaultHashLength,
+		HashSource:    naduke.DefaultHashSource,
+		ContentTag:    naduke.DefaultContentTag,
 	}
 
 	fs := flag.NewFlagSet("naduke", flag.ContinueOnError)
@@ -36,18 +75,127 @@ func parseArgs(args []string) (naduke.Options, []string, bool, *flag.FlagSet, er
 
 	help := fs.Bool("help", false, "Show this help message and exit")
 	helpShort := fs.Bool("h", false, "Show this help message and exit")
+	configPath := fs.String("config", "", "Read default flag values from this TOML file (default: naduke/config.toml in the user config directory, if present)")
+	profile := fs.String("profile", "", "Apply the settings of the [profiles.NAME] table in the config file")
 
 	fs.StringVar(&opts.Host, "host", opts.Host, "Ollama host (default: "+opts.Host+")")
 	fs.IntVar(&opts.Port, "port", opts.Port, "Ollama port (default: "+fmt.Sprint(opts.Port)+")")
 	fs.StringVar(&opts.Server, "server", "", "Full Ollama server URL (overrides host/port)")
+	fs.StringVar(&opts.UserAgent, "user-agent", "naduke/"+toolVersion(), "User-Agent header sent with every request")
+	fs.BoolVar(&opts.PrintURL, "print-url", opts.PrintURL, "Print the resolved request URL, with credentials redacted, before naming files")
+	fs.StringVar(&opts.Socket, "socket", "", "Ollama Unix domain socket path (overrides host/port/server)")
+	fs.BoolVar(&opts.NoProxy, "no-proxy", opts.NoProxy, "Ignore HTTP_PROXY/HTTPS_PROXY/NO_PROXY and connect directly")
 	fs.StringVar(&opts.Model, "model", opts.Model, "Model name (default: "+opts.Model+")")
+	models := fs.String("models", "", "Comma-separated models to try in order; the first that succeeds names the file (replaces -model)")
 	fs.Float64Var(&opts.Temperature, "temperature", opts.Temperature, "Sampling temperature (default: 0.0)")
 	fs.IntVar(&opts.TopK, "top_k", opts.TopK, "Top-k sampling (default: 1)")
 	fs.Float64Var(&opts.TopP, "top_p", opts.TopP, "Top-p sampling (default: 1.0)")
 	fs.Float64Var(&opts.RepeatPenalty, "repeat_penalty", opts.RepeatPenalty, "Repeat penalty (default: 1.0)")
+	fs.Float64Var(&opts.MinP, "min-p", opts.MinP, "Min-p sampling (default: unset)")
+	fs.IntVar(&opts.Mirostat, "mirostat", opts.Mirostat, "Mirostat sampling mode: 0 disabled, 1 Mirostat, 2 Mirostat 2.0 (default: unset)")
+	fs.Float64Var(&opts.MirostatEta, "mirostat-eta", opts.MirostatEta, "Mirostat learning rate (default: unset)")
+	fs.Float64Var(&opts.MirostatTau, "mirostat-tau", opts.MirostatTau, "Mirostat target entropy (default: unset)")
+	fs.IntVar(&opts.Retries, "retries", opts.Retries, "Re-prompts when the model returns an invalid name (default: "+fmt.Sprint(opts.Retries)+")")
+	fs.Float64Var(&opts.TempStep, "temperature-step", opts.TempStep, "Temperature increase per re-prompt (default: "+fmt.Sprint(opts.TempStep)+")")
+	fs.Float64Var(&opts.MaxTemp, "max-temperature", opts.MaxTemp, "Upper bound for escalated temperature (default: "+fmt.Sprint(opts.MaxTemp)+")")
+	fs.BoolVar(&opts.RotatePrompts, "retry-different-prompt", opts.RotatePrompts, "Word the request differently on each re-prompt after an invalid name")
+	fs.Var(stringListFlag{&opts.RetryPrompts}, "retry-prompt", "Wording used by -retry-different-prompt instead of the built-in ones (repeatable; implies -retry-different-prompt)")
+	fs.BoolVar(&opts.Recursive, "recursive", opts.Recursive, "Descend into directory arguments and name every file below them")
+	opts.OnlyExts = map[string]bool{}
+	fs.Var(extListFlag(opts.OnlyExts), "ext", "Only process files with this extension, e.g. .md (repeatable)")
+	since := fs.String("since", "", "Only name files modified within a duration (24h, 7d) or since a date (2006-01-02)")
+	minSize := fs.String("min-size", "", "Skip files smaller than this size, e.g. 1k")
+	maxSize := fs.String("max-size", "", "Skip files larger than this size, e.g. 10M")
+	fs.Float64Var(&opts.EntropyThreshold, "entropy-threshold", opts.EntropyThreshold, "Skip files whose sample exceeds this entropy in bits per character, e.g. 5.5 for base64 blobs (default: off)")
+	fs.IntVar(&opts.Jobs, "jobs", opts.Jobs, "Number of files to name concurrently (default: "+fmt.Sprint(opts.Jobs)+")")
+	fs.IntVar(&opts.MemoryCache, "memory-cache", opts.MemoryCache, "Remember this many model answers and reuse them for identical requests (default: 0, off)")
+	opts.HostConcurrency = map[string]int{}
+	fs.Var(hostConcurrencyFlag(opts.HostConcurrency), "host-concurrency", "Cap concurrent requests to a server host, e.g. gpu1:11434=2 (repeatable; others use -jobs)")
+	fs.IntVar(&opts.Batch, "batch", opts.Batch, "Name up to this many small files per request (default: off)")
+	fs.IntVar(&opts.BatchTokens, "batch-tokens", naduke.DefaultBatchTokens, "Estimated token budget of one -batch request (default: "+fmt.Sprint(naduke.DefaultBatchTokens)+")")
+	fs.BoolVar(&opts.Warmup, "warmup", opts.Warmup, "Load the model(s) with an empty request before naming files")
+	fs.Var(stringListFlag{&opts.RequiredCapabilities}, "require-capability", "Fail at startup unless every model reports this capability, e.g. vision or tools (repeatable)")
+	fs.BoolVar(&opts.RequestID, "request-id", opts.RequestID, "Send a correlation id header with every request, logged with the file at -v")
+	fs.StringVar(&opts.RequestIDHeader, "request-id-header", naduke.DefaultRequestIDHeader, "Header name for -request-id (default: "+naduke.DefaultRequestIDHeader+")")
+	fs.StringVar(&opts.RequestIDTemplate, "request-id-template", naduke.DefaultRequestIDTemplate, "Value for -request-id; {uuid}, {file} and {path} are expanded (default: "+naduke.DefaultRequestIDTemplate+")")
+	fs.StringVar(&opts.KeepAlive, "keep-alive", opts.KeepAlive, "How long the server keeps the model loaded after a request, e.g. 10m (default: server setting)")
+	fs.IntVar(&opts.HTTPRetries, "http-retries", opts.HTTPRetries, "Retries after a 429 Too Many Requests response (default: "+fmt.Sprint(opts.HTTPRetries)+")")
+	fs.DurationVar(&opts.RequestTimeout, "request-timeout", opts.RequestTimeout, "Give up on a model request after this long for small files, plus as much again per MiB of file size, e.g. 30s; 0 means no limit (default: 0)")
+	fs.DurationVar(&opts.MaxRequestTimeout, "max-request-timeout", naduke.DefaultMaxRequestTimeout, "Ceiling for the size-scaled -request-timeout (default: 5m)")
+	fs.DurationVar(&opts.RunTimeout, "run-timeout", opts.RunTimeout, "Stop starting files and cancel requests in flight once the run has taken this long, e.g. 30m; 0 means no limit (default: 0)")
+	fs.DurationVar(&opts.RetryTimeout, "retry-timeout", opts.RetryTimeout, "Stop retrying a file once this much time has passed since its first request, e.g. 2m; 0 means no limit (default: 0)")
+	fs.IntVar(&opts.RepeatedNameLimit, "abort-on-repeated-names", opts.RepeatedNameLimit, "Stop the run when the model gives the same name for this many files in a row (default: 0, never)")
+	fs.IntVar(&opts.EmptyRetries, "retry-on-empty", opts.EmptyRetries, "Retries after an empty model response (default: "+fmt.Sprint(opts.EmptyRetries)+")")
+	fs.IntVar(&opts.ConfirmAbove, "confirm-threshold", opts.ConfirmAbove, "Ask for confirmation before renaming more than this many files (default: 0, never ask)")
+	fs.BoolVar(&opts.Yes, "yes", opts.Yes, "Answer yes to every confirmation prompt")
+	fs.BoolVar(&opts.Yes, "y", opts.Yes, "Answer yes to every confirmation prompt")
+	examplesFile := fs.String("examples-file", "", "JSON file of few-shot examples, [{\"content\": \"...\", \"name\": \"...\"}], sent before each file")
+	modelfile := fs.String("modelfile", "", "Read sampling PARAMETERs from a Modelfile or key=value file; flags still win")
+	optionsJSON := fs.String("options-json", "", "Extra Ollama options as a JSON object; typed flags win for the keys they cover")
 	fs.BoolVar(&opts.DryRun, "dry-run", opts.DryRun, "Show suggested names without renaming")
+	fs.Func("validate", "Check whether `NAME` passes the naming rules and exit, without files or a model", func(value string) error {
+		opts.Validate, opts.ValidateName = true, value
+		return nil
+	})
+	fs.BoolVar(&opts.JSON, "json", opts.JSON, "Print the results as one JSON array at the end")
+	fs.BoolVar(&opts.JSONStream, "json-stream", opts.JSONStream, "Print one JSON object per line as each file completes")
+	fs.BoolVar(&opts.JSONPretty, "json-pretty", opts.JSONPretty, "Indent -json and -json-stream output for reading; implies -json")
+	fs.BoolVar(&opts.StdinNameList, "stdin-name-list", opts.StdinNameList, "Apply the SOURCE<TAB>NAME pairs (or NUL-separated SOURCE and NAME fields) read from stdin instead of asking the model")
+	fs.BoolVar(&opts.Check, "check", opts.Check, "Dry run that exits with code 5 when any file would get a new name")
+	fs.BoolVar(&opts.NameOnly, "name-only", opts.NameOnly, "Print \"path<TAB>name\" per file without renaming anything")
+	fs.BoolVar(&opts.Sidecar, "sidecar", opts.Sidecar, "Write each suggested name to a FILE.naduke sidecar next to the file instead of renaming")
+	fs.BoolVar(&opts.ShowRaw, "show-raw", opts.ShowRaw, "In dry-run, also print the model's raw answer before sanitization")
+	fs.BoolVar(&opts.ApplyOnConfirm, "apply-on-confirm", opts.ApplyOnConfirm, "With -dry-run, offer to apply the shown plan without asking the model again")
 	fs.StringVar(&opts.Prefix, "prefix", opts.Prefix, "Prefix to prepend to the generated name")
+	fs.BoolVar(&opts.PreserveDatePrefix, "preserve-date-prefix", opts.PreserveDatePrefix, "Keep a leading date from the original file name in front of the generated name")
+	style := fs.String("style", naduke.StyleSnake, "Name style: snake (meeting_notes), kebab (meeting-notes), camel (meetingNotes) or code (parse_http_v2_1) (default: "+naduke.StyleSnake+")")
+	flatten := fs.Bool("flatten-separators", false, "Join the words of every name with the -style separator, even names kept verbatim or from a custom prompt")
+	fs.BoolVar(&opts.StripNumbers, "strip-numbers-from-name", opts.StripNumbers, "Drop a trailing _N the model added, as in report_2, unless it matches -keep-numbers")
+	keepNumbers := fs.String("keep-numbers", naduke.DefaultKeepNumbers, "Regular expression for trailing numbers -strip-numbers-from-name keeps (default: years)")
+	compareToExisting := fs.Bool("compare-to-existing", false, "Only rename files whose current name is non-descriptive, as matched by -bad-name-pattern; leave the rest alone")
+	badNames := fs.String("bad-name-pattern", naduke.DefaultBadNames, "Regular expression for non-descriptive names, without extension, that -compare-to-existing renames (default: untitled, new document, scan001, UUIDs and similar)")
+	datePattern := fs.String("date-pattern", naduke.DefaultDatePattern, "Regular expression matching the date kept by -preserve-date-prefix; group 1 is the date")
 	fs.StringVar(&opts.Dir, "dir", opts.Dir, "Destination directory for renamed files (default: same as source)")
+	requireDir := fs.Bool("require-dir", false, "Fail unless -dir is set, so files are never renamed in place")
+	fs.BoolVar(&opts.PreserveTree, "preserve-tree", opts.PreserveTree, "With -dir and -recursive, recreate each file's directory below its argument under -dir")
+	fs.StringVar(&opts.PromptProfile, "prompt-profile", opts.PromptProfile, "Naming guidance: auto, prose or code (default: "+opts.PromptProfile+")")
+	fs.BoolVar(&opts.PromptLanguageOfContent, "prompt-language-of-content", opts.PromptLanguageOfContent, "Detect each file's language and ask for a romanized name in that language")
+	fs.BoolVar(&opts.UseDirContext, "use-dir-context", opts.UseDirContext, "Tell the model the names of the folders holding each file, e.g. invoices/2024")
+	fs.BoolVar(&opts.FitContext, "fit-context", opts.FitContext, "Ask the server for each model's context length and trim samples that would not fit")
+	fs.BoolVar(&opts.Verbose, "v", opts.Verbose, "Log debug details to stderr")
+	fs.StringVar(&opts.ContentTag, "content-tag", opts.ContentTag, "Tag wrapping the file content in the prompt (default: "+opts.ContentTag+")")
+	fs.BoolVar(&opts.NoExtensionStrip, "no-extension-strip", opts.NoExtensionStrip, "Advanced: keep the model's name as written, removing only path separators and control characters")
+	fs.BoolVar(&opts.BaseNameOnly, "base-name-only", opts.BaseNameOnly, "Refine the current file name using the content instead of replacing it")
+	fs.StringVar(&opts.OnModelError, "on-model-error", opts.OnModelError, "After a model failure on one file: continue with the next file or abort (default: "+opts.OnModelError+")")
+	fs.StringVar(&opts.OnFSError, "on-fs-error", opts.OnFSError, "After a filesystem failure on one file: continue with the next file or abort (default: "+opts.OnFSError+")")
+	fs.StringVar(&opts.OnEmpty, "on-empty", naduke.EmptyAsk, "For an empty file: ask the model anyway, skip it, name-default (use -empty-name) or error (default: "+naduke.EmptyAsk+")")
+	fs.StringVar(&opts.EmptyName, "empty-name", naduke.DefaultEmptyName, "Name given to empty files with -on-empty name-default (default: "+naduke.DefaultEmptyName+")")
+	fs.StringVar(&opts.OnAmbiguous, "on-ambiguous", opts.OnAmbiguous, "When the answer sanitizes to just \"file\": keep the current name, hash (file_<hash>) or file (default: "+opts.OnAmbiguous+")")
+	fs.StringVar(&opts.OnCollision, "on-collision", opts.OnCollision, "When the destination is taken: error, suffix (name_2) or hash (name_<hash>) (default: "+opts.OnCollision+")")
+	fs.IntVar(&opts.HashLength, "hash-length", opts.HashLength, "Hex digits appended by -on-collision hash (default: "+fmt.Sprint(opts.HashLength)+")")
+	fs.StringVar(&opts.HashAlgorithm, "hash-algo", naduke.DefaultHashAlgorithm, "Content hash for -on-collision hash, -dedupe and -memory-cache: sha256, sha1 or sha512 (default: "+naduke.DefaultHashAlgorithm+")")
+	fs.StringVar(&opts.HashSource, "hash-source", opts.HashSource, "Content hashed by -on-collision hash: file or sample (default: "+opts.HashSource+")")
+	fs.BoolVar(&opts.Dedupe, "dedupe", opts.Dedupe, "Name one file per identical content and give its duplicates the same name with a counter")
+	fs.BoolVar(&opts.Link, "link", opts.Link, "Create a hardlink under the new name and keep the original")
+	fs.BoolVar(&opts.Symlink, "symlink", opts.Symlink, "Create a symlink under the new name pointing at the original")
+	fs.BoolVar(&opts.PreserveOriginalXattr, "preserve-original-in-xattr", opts.PreserveOriginalXattr, "Store the original path in the user.naduke.original extended attribute of each renamed file")
+	fs.BoolVar(&opts.AllowExt, "allow-ext", opts.AllowExt, "Let the model suggest an extension from -allowed-exts")
+	allowedExts := fs.String("allowed-exts", naduke.DefaultAllowedExts, "Comma-separated extensions the model may suggest with -allow-ext")
+	opts.ExtRewrites = map[string]string{}
+	fs.Var(extRewriteFlag(opts.ExtRewrites), "rewrite-ext", "Rewrite a matching extension, e.g. txt=json (repeatable)")
+	opts.ModelForExt = map[string]string{}
+	fs.Var(modelForFlag(opts.ModelForExt), "model-for", "Use another model for an extension, e.g. go=qwen2.5-coder (repeatable)")
+	fs.StringVar(&opts.ContentSource, "content-source", naduke.DefaultContentSource, "Build the sample from: content, metadata (ID3 tags of MP3s, EXIF of JPEG and TIFF images; files without them are skipped) or auto (metadata when present, else content) (default: "+naduke.DefaultContentSource+")")
+	fs.BoolVar(&opts.ReadArchives, "read-archives", opts.ReadArchives, "Name .zip and .tar(.gz) archives from their entry names and README, without extracting")
+	fs.BoolVar(&opts.TrimNameFromContent, "trim-name-from-content", opts.TrimNameFromContent, "Remove the current file name from the start of the sample so the model does not echo it")
+	sampleEncoding := fs.String("sample-encoding", naduke.EncodingUTF8, "Encoding of the file bytes: utf-8, utf-16le, utf-16be or latin1 (default: "+naduke.EncodingUTF8+")")
+	fs.BoolVar(&opts.LenientUTF8, "lenient-utf8", opts.LenientUTF8, "Replace invalid UTF-8 in the sample with U+FFFD instead of rejecting the file")
+	fs.Var(regexpListFlag{&opts.Prefilters}, "prefilter", "Remove matches of this regular expression from the sample before it is cut, e.g. (?s)CONFIDENTIAL.*?\\n\\n (repeatable)")
+	fs.BoolVar(&opts.NormalizeWhitespace, "normalize-whitespace", opts.NormalizeWhitespace, "Collapse whitespace runs and drop blank lines in the sample")
+	fs.BoolVar(&opts.StripEmoji, "strip-emoji", opts.StripEmoji, "Remove emoji and other symbols from the sample and from the model's answer")
+	fs.BoolVar(&opts.TrimAtNewline, "trim-sample-at-newlines", opts.TrimAtNewline, "Cut a truncated sample back to its last complete line")
+	fs.BoolVar(&opts.TrimAtSentence, "trim-sample-to-sentence", opts.TrimAtSentence, "Cut a truncated sample back to its last complete sentence")
+	headTailSplit := fs.String("head-tail-split", "100/0", "Percentages of a long file's sample taken from its start and its end, e.g. 70/30 (default: 100/0, start only)")
 
 	if err := fs.Parse(args); err != nil {
 		return opts, nil, false, fs, err
@@ -56,6 +204,237 @@ func parseArgs(args []string) (naduke.Options, []string, bool, *flag.FlagSet, er
 	if *help || *helpShort {
 		return opts, nil, true, fs, nil
 	}
+	// Flags given on the command line, as opposed to set by the config file.
+	commandLine := map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) { commandLine[fl.Name] = true })
+	if err := applyConfig(fs, *configPath, *profile); err != nil {
+		return opts, nil, false, fs, err
+	}
+
+	if _, err := naduke.ParseProfile(opts.PromptProfile); err != nil {
+		return opts, nil, false, fs, err
+	}
+
+	if err := naduke.ValidateContentTag(opts.ContentTag); err != nil {
+		return opts, nil, false, fs, err
+	}
+	if err := naduke.ParseAmbiguous(opts.OnAmbiguous); err != nil {
+		return opts, nil, false, fs, err
+	}
+	if err := naduke.ParseOnEmpty(opts.OnEmpty); err != nil {
+		return opts, nil, false, fs, err
+	}
+	if _, err := naduke.ValidateSuggestion(opts.EmptyName); err != nil && opts.OnEmpty == naduke.EmptyNameDefault {
+		return opts, nil, false, fs, fmt.Errorf("invalid -empty-name: %w", err)
+	}
+	for _, policy := range []string{opts.OnModelError, opts.OnFSError} {
+		if err := naduke.ParseErrorPolicy(policy); err != nil {
+			return opts, nil, false, fs, err
+		}
+	}
+	if err := naduke.ParseCollision(opts.OnCollision); err != nil {
+		return opts, nil, false, fs, err
+	}
+	if err := naduke.ParseContentSource(opts.ContentSource); err != nil {
+		return opts, nil, false, fs, err
+	}
+	if err := naduke.ParseHashAlgorithm(opts.HashAlgorithm); err != nil {
+		return opts, nil, false, fs, err
+	}
+	if n := naduke.HashHexLength(opts); opts.HashLength < 1 || opts.HashLength > n {
+		return opts, nil, false, fs, fmt.Errorf("hash-length must be between 1 and %d for %s: %d", n, opts.HashAlgorithm, opts.HashLength)
+	}
+	if opts.HashSource != naduke.HashSourceFile && opts.HashSource != naduke.HashSourceSample {
+		return opts, nil, false, fs, fmt.Errorf("unknown hash source %q (want %s or %s)", opts.HashSource, naduke.HashSourceFile, naduke.HashSourceSample)
+	}
+
+	pattern, err := regexp.Compile(*datePattern)
+	if err != nil {
+		return opts, nil, false, fs, fmt.Errorf("invalid -date-pattern: %w", err)
+	}
+	opts.DatePattern = pattern
+	if opts.Sanitizer, err = naduke.ParseStyle(*style); err != nil {
+		return opts, nil, false, fs, err
+	}
+	if *flatten {
+		sep, ok := naduke.StyleSeparator(*style)
+		if !ok {
+			return opts, nil, false, fs, fmt.Errorf("-flatten-separators needs a style with a separator, not %s", *style)
+		}
+		opts.FlattenSeparators = sep
+	}
+	if opts.SampleEncoding, err = naduke.ParseSampleEncoding(*sampleEncoding); err != nil {
+		return opts, nil, false, fs, err
+	}
+	if opts.HeadTailSplit, err = naduke.ParseHeadTailSplit(*headTailSplit); err != nil {
+		return opts, nil, false, fs, err
+	}
+	if opts.KeepNumbers, err = regexp.Compile(*keepNumbers); err != nil {
+		return opts, nil, false, fs, fmt.Errorf("invalid -keep-numbers: %w", err)
+	}
+	if *compareToExisting {
+		if opts.BadNames, err = regexp.Compile(*badNames); err != nil {
+			return opts, nil, false, fs, fmt.Errorf("invalid -bad-name-pattern: %w", err)
+		}
+	}
+
+	// -model on the command line overrides models from the config file, and
+	// models from anywhere override a model from the config file.
+	if commandLine["model"] && commandLine["models"] {
+		return opts, nil, false, fs, fmt.Errorf("-model and -models cannot be combined")
+	}
+	if *models != "" && !commandLine["model"] {
+		var list []string
+		for _, model := range strings.Split(*models, ",") {
+			if model = strings.TrimSpace(model); model != "" {
+				list = append(list, model)
+			}
+		}
+		if len(list) == 0 {
+			return opts, nil, false, fs, fmt.Errorf("invalid models: %q", *models)
+		}
+		opts.Model, opts.FallbackModels = list[0], list[1:]
+	}
+
+	if opts.RequestID {
+		if opts.RequestIDHeader == "" || strings.ContainsAny(opts.RequestIDHeader, " :\t\r\n") {
+			return opts, nil, false, fs, fmt.Errorf("invalid request-id-header: %q", opts.RequestIDHeader)
+		}
+		if opts.RequestIDTemplate == "" {
+			return opts, nil, false, fs, fmt.Errorf("request-id-template must not be empty")
+		}
+	}
+
+	if opts.JSON && opts.JSONStream {
+		return opts, nil, false, fs, fmt.Errorf("-json and -json-stream cannot be combined")
+	}
+	if opts.JSONPretty && !opts.JSONStream {
+		opts.JSON = true
+	}
+	if opts.ApplyOnConfirm && (opts.JSON || opts.JSONStream) {
+		// The prompt and the apply report would follow the JSON on stdout.
+		return opts, nil, false, fs, fmt.Errorf("-apply-on-confirm cannot be combined with -json or -json-stream")
+	}
+	if opts.NameOnly {
+		if opts.JSON || opts.JSONStream || opts.ApplyOnConfirm {
+			return opts, nil, false, fs, fmt.Errorf("-name-only cannot be combined with -json, -json-stream or -apply-on-confirm")
+		}
+		// Only names are printed, so nothing may be renamed.
+		opts.DryRun = true
+	}
+	if opts.Check {
+		if opts.ApplyOnConfirm {
+			return opts, nil, false, fs, fmt.Errorf("-check cannot be combined with -apply-on-confirm")
+		}
+		opts.DryRun = true
+	}
+
+	if *requireDir && opts.Dir == "" && !opts.Validate {
+		return opts, nil, false, fs, fmt.Errorf("-require-dir is set but -dir is not")
+	}
+
+	if opts.PreserveTree && opts.Dir == "" {
+		return opts, nil, false, fs, fmt.Errorf("-preserve-tree requires -dir")
+	}
+
+	if opts.Sidecar && (opts.Dir != "" || opts.Link || opts.Symlink || opts.NameOnly || opts.ApplyOnConfirm) {
+		return opts, nil, false, fs, fmt.Errorf("-sidecar cannot be combined with -dir, -link, -symlink, -name-only or -apply-on-confirm")
+	}
+	if opts.Link && opts.Symlink {
+		return opts, nil, false, fs, fmt.Errorf("-link and -symlink cannot be combined")
+	}
+	for _, ext := range strings.Split(*allowedExts, ",") {
+		if ext = strings.TrimPrefix(strings.TrimSpace(ext), "."); ext != "" {
+			opts.AllowedExts = append(opts.AllowedExts, ext)
+		}
+	}
+
+	if opts.Retries < 0 {
+		return opts, nil, false, fs, fmt.Errorf("retries must not be negative: %d", opts.Retries)
+	}
+	if opts.Batch < 0 || opts.BatchTokens < 1 {
+		return opts, nil, false, fs, fmt.Errorf("batch must not be negative and batch-tokens must be at least 1")
+	}
+	if opts.Batch > 1 && (opts.AllowExt || opts.BaseNameOnly || opts.PromptLanguageOfContent || opts.UseDirContext || *examplesFile != "") {
+		return opts, nil, false, fs, fmt.Errorf("-batch cannot be combined with -allow-ext, -base-name-only, -prompt-language-of-content, -use-dir-context or -examples-file")
+	}
+	if opts.MemoryCache < 0 {
+		return opts, nil, false, fs, fmt.Errorf("memory-cache must not be negative: %d", opts.MemoryCache)
+	}
+	if opts.Jobs < 1 {
+		return opts, nil, false, fs, fmt.Errorf("jobs must be at least 1: %d", opts.Jobs)
+	}
+	if opts.HTTPRetries < 0 {
+		return opts, nil, false, fs, fmt.Errorf("http-retries must not be negative: %d", opts.HTTPRetries)
+	}
+	if len(opts.RetryPrompts) > 0 {
+		opts.RotatePrompts = true
+	}
+	if opts.RequestTimeout < 0 || opts.MaxRequestTimeout < 0 {
+		return opts, nil, false, fs, fmt.Errorf("request timeouts must not be negative: %s, %s", opts.RequestTimeout, opts.MaxRequestTimeout)
+	}
+	if opts.MaxRequestTimeout > 0 && opts.RequestTimeout > opts.MaxRequestTimeout {
+		return opts, nil, false, fs, fmt.Errorf("request-timeout %s exceeds max-request-timeout %s", opts.RequestTimeout, opts.MaxRequestTimeout)
+	}
+	if opts.RunTimeout < 0 {
+		return opts, nil, false, fs, fmt.Errorf("run-timeout must not be negative: %s", opts.RunTimeout)
+	}
+	if opts.RetryTimeout < 0 {
+		return opts, nil, false, fs, fmt.Errorf("retry-timeout must not be negative: %s", opts.RetryTimeout)
+	}
+	if opts.RepeatedNameLimit < 0 || opts.RepeatedNameLimit == 1 {
+		return opts, nil, false, fs, fmt.Errorf("abort-on-repeated-names must be 0 or at least 2: %d", opts.RepeatedNameLimit)
+	}
+	if opts.KeepAlive != "" {
+		if _, err := time.ParseDuration(opts.KeepAlive); err != nil {
+			return opts, nil, false, fs, fmt.Errorf("invalid -keep-alive %q: %w", opts.KeepAlive, err)
+		}
+	}
+	if opts.EmptyRetries < 0 {
+		return opts, nil, false, fs, fmt.Errorf("retry-on-empty must not be negative: %d", opts.EmptyRetries)
+	}
+
+	if *since != "" {
+		cutoff, err := naduke.ParseSince(*since, time.Now())
+		if err != nil {
+			return opts, nil, false, fs, err
+		}
+		opts.Since = cutoff
+	}
+
+	for _, limit := range []struct {
+		value string
+		dst   *int64
+	}{{*minSize, &opts.MinSize}, {*maxSize, &opts.MaxSize}} {
+		if limit.value == "" {
+			continue
+		}
+		size, err := naduke.ParseSize(limit.value)
+		if err != nil {
+			return opts, nil, false, fs, err
+		}
+		*limit.dst = size
+	}
+	if opts.EntropyThreshold < 0 {
+		return opts, nil, false, fs, fmt.Errorf("entropy-threshold must not be negative: %v", opts.EntropyThreshold)
+	}
+	if opts.MaxSize > 0 && opts.MinSize > opts.MaxSize {
+		return opts, nil, false, fs, fmt.Errorf("-min-size %s is larger than -max-size %s", *minSize, *maxSize)
+	}
+
+	if *modelfile != "" {
+		if err := applyModelfile(fs, &opts, *modelfile); err != nil {
+			return opts, nil, false, fs, err
+		}
+	}
+
+	if *optionsJSON != "" {
+		extra, err := naduke.ParseOptionsJSON(*optionsJSON)
+		if err != nil {
+			return opts, nil, false, fs, err
+		}
+		opts.ExtraOptions = extra
+	}
 
 	if opts.Dir != "" {
 		info, err := os.Stat(opts.Dir)
@@ -67,7 +446,26 @@ func parseArgs(args []string) (naduke.Options, []string, bool, *flag.FlagSet, er
 		}
 	}
 
+	if *examplesFile != "" {
+		if opts.Examples, err = loadExamples(*examplesFile, opts); err != nil {
+			return opts, nil, false, fs, err
+		}
+	}
+
 	files := fs.Args()
+	if opts.Validate {
+		// Validation needs no files; any given are ignored.
+		return opts, nil, false, fs, nil
+	}
+	if opts.StdinNameList {
+		if len(files) > 0 {
+			return opts, nil, false, fs, fmt.Errorf("-stdin-name-list reads its files from stdin; remove the file arguments")
+		}
+		if opts.Recursive || opts.Batch > 1 || opts.Dedupe || opts.HashSource == naduke.HashSourceSample {
+			return opts, nil, false, fs, fmt.Errorf("-stdin-name-list cannot be combined with -recursive, -batch, -dedupe or -hash-source sample")
+		}
+		return opts, nil, false, fs, nil
+	}
 	if len(files) == 0 {
 		return opts, nil, false, fs, fmt.Errorf("no files provided")
 	}
@@ -75,60 +473,394 @@ func parseArgs(args []string) (naduke.Options, []string, bool, *flag.FlagSet, er
 	return opts, files, false, fs, nil
 }
 
+// validateName reports whether opts.ValidateName passes the naming rules
+// set by the other flags, and what a rejected name would be sanitized to.
+func validateName(stdout, stderr io.Writer, opts naduke.Options) int {
+	name, err := naduke.ValidateFor(opts, opts.ValidateName)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		fmt.Fprintf(stderr, "would be sanitized to: %s\n", naduke.SanitizeSuggestion(opts.ValidateName, opts))
+		return exitCode(err)
+	}
+	fmt.Fprintf(stdout, "valid: %s\n", name)
+	return exitOK
+}
+
+// loadExamples reads the -examples-file at path.
+func loadExamples(path string, opts naduke.Options) ([]naduke.Example, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open examples file: %w", err)
+	}
+	defer f.Close()
+	return naduke.ParseExamples(f, opts)
+}
+
+// modelfileFlags maps Modelfile parameter names to the flags that set them.
+var modelfileFlags = map[string]string{
+	"temperature":    "temperature",
+	"top_k":          "top_k",
+	"top_p":          "top_p",
+	"repeat_penalty": "repeat_penalty",
+	"min_p":          "min-p",
+	"mirostat":       "mirostat",
+	"mirostat_eta":   "mirostat-eta",
+	"mirostat_tau":   "mirostat-tau",
+}
+
+// applyModelfile loads sampling parameters from path into opts, leaving any
+// parameter whose flag was given on the command line alone.
+func applyModelfile(fs *flag.FlagSet, opts *naduke.Options, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open modelfile: %w", err)
+	}
+	defer f.Close()
+
+	params, err := naduke.ParseModelfile(f)
+	if err != nil {
+		return err
+	}
+	explicit := map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) { explicit[fl.Name] = true })
+	return naduke.ApplyModelParameters(opts, params, func(param string) bool {
+		return explicit[modelfileFlags[param]]
+	})
+}
+
+// confirm prints question to out and reports whether the answer read from in
+// is yes. Anything else, including EOF, counts as no.
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// confirmEnter is like confirm but treats an empty answer as yes, so pressing
+// Enter accepts.
+func confirmEnter(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [Y/n] ", question)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "", "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// isTerminal reports whether f is an interactive character device.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmBatch asks before renaming more than opts.ConfirmAbove files. It
+// refuses to continue when stdin cannot answer the prompt, unless -yes
+// already answered it.
+func confirmBatch(opts naduke.Options, count int) error {
+	if opts.DryRun || opts.ConfirmAbove <= 0 || count <= opts.ConfirmAbove || opts.Yes {
+		return nil
+	}
+	if !isTerminal(os.Stdin) {
+		return fmt.Errorf("refusing to rename %d files without confirmation: stdin is not a terminal (use -yes)", count)
+	}
+	if !confirm(os.Stdin, os.Stdout, fmt.Sprintf("About to rename %d files. Proceed?", count)) {
+		return fmt.Errorf("aborted: %d files left unchanged", count)
+	}
+	return nil
+}
+
+// Exit codes let scripts tell failure categories apart.
+const (
+	exitOK         = 0
+	exitUsage      = 1
+	exitModel      = 2
+	exitFilesystem = 3
+	exitValidation = 4
+	exitChanged    = 5
+	exitTimedOut   = 6
+	// exitInterrupted follows the shell convention of 128+SIGINT.
+	exitInterrupted = 130
+)
+
+var errEmptyPath = errors.New("empty file path")
+
+// errRunTimeout is the cause of a run canceled by -run-timeout.
+var errRunTimeout = errors.New("run timed out")
+
+// exitCode maps an error to the exit code for its category.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case naduke.IsModelError(err):
+		return exitModel
+	case naduke.IsFilesystemError(err):
+		return exitFilesystem
+	case errors.Is(err, naduke.ErrNotText),
+		errors.Is(err, naduke.ErrEmptySample),
+		errors.Is(err, naduke.ErrInvalidSuggestion),
+		errors.Is(err, naduke.ErrUnsafeName),
+		errors.Is(err, errEmptyPath):
+		return exitValidation
+	default:
+		return exitUsage
+	}
+}
+
+// handleInterrupts calls stop on the first SIGINT and force on the second,
+// after which SIGINT gets its default handling back. The returned function
+// stops listening.
+func handleInterrupts(stderr io.Writer, stop, force func()) func() {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sigs:
+		case <-done:
+			return
+		}
+		fmt.Fprintln(stderr, "Interrupted: finishing files in progress (press Ctrl-C again to quit)")
+		stop()
+		select {
+		case <-sigs:
+		case <-done:
+			return
+		}
+		force()
+		signal.Stop(sigs)
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
 func main() {
-	opts, files, help, fs, err := parseArgs(os.Args[1:])
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the CLI with args and returns the process exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	opts, files, help, fs, err := parseArgs(args)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		fmt.Println()
+		fmt.Fprintln(stderr, err)
+		fmt.Fprintln(stdout)
+		fs.SetOutput(stdout)
 		usage(fs)()
-		os.Exit(1)
+		return exitUsage
 	}
 	if help {
+		fs.SetOutput(stdout)
 		usage(fs)()
-		return
+		return exitOK
 	}
 
-	client, err := naduke.NewClient(opts)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error:", err)
-		os.Exit(1)
+	if opts.Verbose {
+		slog.SetDefault(slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: slog.LevelDebug})))
 	}
 
-	for _, path := range files {
-		if strings.TrimSpace(path) == "" {
-			fmt.Fprintln(os.Stderr, "Error: empty file path")
-			os.Exit(1)
+	if opts.Validate {
+		return validateName(stdout, stderr, opts)
+	}
+
+	// -run-timeout counts from here and stops the run as Ctrl-C twice would.
+	runCtx, cancelRun := context.WithCancelCause(context.Background())
+	defer cancelRun(nil)
+	if opts.RunTimeout > 0 {
+		timer := time.AfterFunc(opts.RunTimeout, func() { cancelRun(errRunTimeout) })
+		defer timer.Stop()
+	}
+
+	if uri, err := naduke.RequestURL(opts); err == nil {
+		slog.Debug("request url", "url", uri)
+		if opts.PrintURL {
+			fmt.Fprintln(stderr, "url:", uri)
 		}
+	}
 
-		sample, err := naduke.ReadSample(path)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-			os.Exit(1)
+	var names nameList
+	if opts.StdinNameList {
+		if names, err = readNameList(stdin); err != nil {
+			fmt.Fprintln(stderr, "Error:", err)
+			return exitUsage
 		}
+		files = names.files
+	}
 
-		text, err := naduke.EnsureTextSample(sample, path)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-			os.Exit(1)
+	if opts.PreserveTree {
+		opts.TreeRoots = naduke.TreeRoots(files)
+	}
+	files, err = naduke.CollectFiles(files, opts)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return exitCode(err)
+	}
+	files, skipped := naduke.FilterSize(files, opts)
+	if !opts.StdinNameList {
+		// A reviewed name list applies whatever the files hold.
+		var wellNamed, untagged, empty, noisy []naduke.SkippedFile
+		files, wellNamed = naduke.FilterBadNames(files, opts)
+		files, untagged = naduke.FilterMetadata(files, opts)
+		files, empty = naduke.FilterEmpty(files, opts)
+		files, noisy = naduke.FilterEntropy(files, opts)
+		skipped = slices.Concat(skipped, wellNamed, untagged, empty, noisy)
+	}
+	for _, skip := range skipped {
+		fmt.Fprintf(stderr, "skipped: %s (%s)\n", skip.Path, skip.Reason)
+	}
+
+	if opts.Dedupe {
+		opts.DuplicateOf = naduke.FindDuplicates(files, opts)
+		for _, path := range files {
+			if representative, ok := opts.DuplicateOf[path]; ok {
+				fmt.Fprintf(stderr, "duplicate: %s (same content as %s)\n", path, representative)
+			}
 		}
+	}
 
-		rawName, err := client.GenerateName(opts.Model, opts.Temperature, opts.TopK, opts.TopP, opts.RepeatPenalty, text)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-			os.Exit(1)
+	// Renames into a read-only directory would only fail after a model call.
+	if !opts.DryRun {
+		if err := naduke.CheckWritable(files, opts); err != nil {
+			fmt.Fprintln(stderr, "Error:", err)
+			return exitCode(err)
 		}
+	}
 
-		newName := naduke.ApplyPrefix(opts.Prefix, naduke.SanitizeName(rawName))
-		destination := naduke.DestinationPath(path, newName, opts.Dir)
+	if err := confirmBatch(opts, len(files)); err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return exitUsage
+	}
 
-		if opts.DryRun {
-			fmt.Printf("%s -> %s\n", path, destination)
-			continue
+	client, err := naduke.NewClient(opts)
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return exitUsage
+	}
+
+	// The probes count against -run-timeout too.
+	if err := client.WithContext(runCtx).RequireCapabilities(opts); err != nil {
+		if runTimedOut(runCtx) {
+			return reportTimeout(stderr, opts, 0, len(files))
+		}
+		fmt.Fprintln(stderr, "Error:", err)
+		return exitCode(err)
+	}
+	if opts.Warmup {
+		if err := client.WithContext(runCtx).Warmup(opts); err != nil {
+			if runTimedOut(runCtx) {
+				return reportTimeout(stderr, opts, 0, len(files))
+			}
+			fmt.Fprintln(stderr, "Error:", err)
+			return exitCode(err)
 		}
+	}
+
+	// The first Ctrl-C stops new files from starting; a second one also
+	// cancels the model requests still in flight.
+	scheduling, stopScheduling := context.WithCancel(runCtx)
+	defer stopScheduling()
+	requests, cancelRequests := context.WithCancel(runCtx)
+	defer cancelRequests()
+	defer handleInterrupts(stderr, stopScheduling, cancelRequests)()
+
+	// Entries come back in file order whatever order the workers finish in,
+	// and stop short of the first failure that aborts the run; the others are
+	// reported and skipped. Each one is applied and printed as soon as every
+	// file before it is done.
+	var namer suggester = client.WithContext(requests)
+	if opts.StdinNameList {
+		namer = names
+	} else if opts.Batch > 1 {
+		namer = newBatchSuggester(client.WithContext(requests), opts, files)
+	}
+	var failures []error
+	plan, planErr := buildPlan(scheduling, namer, opts, files, func(entry planEntry) error {
+		if !opts.DryRun {
+			if err := applyEntry(opts, entry); err != nil {
+				return err
+			}
+		}
+		printEntry(stdout, opts, entry)
+		return nil
+	}, func(path string, err error) {
+		failures = append(failures, err)
+		fmt.Fprintf(stderr, "failed: %s (%v)\n", path, err)
+	})
+	interrupted := scheduling.Err() != nil
+	if interrupted && errors.Is(planErr, context.Canceled) {
+		planErr = nil
+	}
+	if opts.JSON {
+		// Whatever was completed is reported, even when the run stops early.
+		if err := printPlanJSON(stdout, opts, plan); err != nil {
+			fmt.Fprintln(stderr, "Error:", err)
+			return exitUsage
+		}
+	}
+	if planErr != nil {
+		fmt.Fprintln(stderr, "Error:", planErr)
+		return exitCode(planErr)
+	}
+	if interrupted && runTimedOut(scheduling) {
+		return reportTimeout(stderr, opts, len(plan), len(files))
+	}
+	if interrupted {
+		fmt.Fprintf(stderr, "Interrupted: %d of %d file(s) completed\n", len(plan), len(files))
+		return exitInterrupted
+	}
+
+	if opts.DryRun && opts.ApplyOnConfirm && offerApply(os.Stdin, stdout, isTerminal(os.Stdin), opts, plan) {
+		if err := applyPlan(opts, plan, stdout); err != nil {
+			fmt.Fprintln(stderr, "Error:", err)
+			return exitCode(err)
+		}
+	}
+	if len(failures) > 0 {
+		fmt.Fprintf(stderr, "Error: %d of %d file(s) failed\n", len(failures), len(files))
+		return exitCode(failures[0])
+	}
+	if opts.Check {
+		if changed := countChanged(plan); changed > 0 {
+			fmt.Fprintf(stderr, "check: %d of %d file(s) would be renamed\n", changed, len(files))
+			return exitChanged
+		}
+	}
+	return exitOK
+}
+
+// runTimedOut reports whether ctx was canceled by -run-timeout.
+func runTimedOut(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errRunTimeout)
+}
+
+// reportTimeout prints the partial summary of a run stopped by -run-timeout
+// and returns its exit code.
+func reportTimeout(stderr io.Writer, opts naduke.Options, done, total int) int {
+	fmt.Fprintf(stderr, "Timed out: %d of %d file(s) completed within %s\n", done, total, opts.RunTimeout)
+	return exitTimedOut
+}
 
-		if err := naduke.RenameFile(path, newName, opts.Dir); err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-			os.Exit(1)
+// countChanged returns how many entries of plan would move to another path.
+func countChanged(plan []planEntry) int {
+	changed := 0
+	for _, entry := range plan {
+		if !entry.Unchanged {
+			changed++
 		}
 	}
+	return changed
 }
@@ -1,8 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/takai/naduke/internal/naduke"
 )
 
 func TestParseArgsDirMustExist(t *testing.T) {
@@ -18,3 +30,855 @@ func TestParseArgsDirMustExist(t *testing.T) {
 		t.Fatalf("unexpected error for existing dir: %v", err)
 	}
 }
+
+func TestParseArgsOptionsJSON(t *testing.T) {
+	t.Parallel()
+
+	opts, _, _, _, err := parseArgs([]string{"-options-json", `{"num_ctx":4096,"seed":7}`, "file.txt"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.ExtraOptions["num_ctx"] != float64(4096) || opts.ExtraOptions["seed"] != float64(7) {
+		t.Fatalf("unexpected extra options: %v", opts.ExtraOptions)
+	}
+
+	for _, raw := range []string{`{"num_ctx":`, `[1,2]`, `"text"`} {
+		if _, _, _, _, err := parseArgs([]string{"-options-json", raw, "file.txt"}); err == nil {
+			t.Fatalf("expected error for options JSON %s", raw)
+		}
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		answer string
+		want   bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if got := confirm(strings.NewReader(tt.answer), &out, "Proceed?"); got != tt.want {
+			t.Fatalf("confirm(%q) = %v; want %v", tt.answer, got, tt.want)
+		}
+		if out.String() != "Proceed? [y/N] " {
+			t.Fatalf("unexpected prompt: %q", out.String())
+		}
+	}
+}
+
+func TestConfirmBatchThreshold(t *testing.T) {
+	t.Parallel()
+
+	opts := naduke.Options{ConfirmAbove: 3}
+	if err := confirmBatch(opts, 3); err != nil {
+		t.Fatalf("batch at threshold should proceed silently: %v", err)
+	}
+	dry := opts
+	dry.DryRun = true
+	if err := confirmBatch(dry, 10); err != nil {
+		t.Fatalf("dry-run should never ask: %v", err)
+	}
+	// Test stdin never answers yes, so a large batch must be refused.
+	if err := confirmBatch(opts, 4); err == nil {
+		t.Fatalf("expected refusal above threshold without a terminal")
+	}
+
+	yes, _, _, _, err := parseArgs([]string{"-confirm-threshold", "3", "-y", "a", "b", "c", "d"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := confirmBatch(yes, 4); err != nil {
+		t.Fatalf("-y should approve the batch: %v", err)
+	}
+}
+
+func TestParseArgsYesKeepsSafetyChecks(t *testing.T) {
+	t.Parallel()
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	if _, _, _, _, err := parseArgs([]string{"-yes", "-dir", missing, "file.txt"}); err == nil {
+		t.Fatalf("-yes must not bypass argument validation")
+	}
+}
+
+// fakeOllama serves /api/chat with the given status and message content.
+func fakeOllama(t *testing.T, status int, content string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			w.Write([]byte(`{"error":"boom"}`))
+			return
+		}
+		w.Write([]byte(`{"message":{"role":"assistant","content":"` + content + `"}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func writeFile(t *testing.T, dir, name string, content []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestRunExitCodes(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	text := writeFile(t, dir, "note.txt", []byte("meeting notes"))
+	binary := writeFile(t, dir, "blob.txt", []byte("bin\x00ary"))
+	ok := fakeOllama(t, http.StatusOK, "meeting_notes")
+	failing := fakeOllama(t, http.StatusInternalServerError, "")
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"usage", []string{"-server", ok.URL}, exitUsage},
+		{"dry-run", []string{"-server", ok.URL, "-dry-run", text}, exitOK},
+		{"model", []string{"-server", failing.URL, "-dry-run", text}, exitModel},
+		{"filesystem", []string{"-server", ok.URL, "-dry-run", filepath.Join(dir, "missing.txt")}, exitFilesystem},
+		{"validation", []string{"-server", ok.URL, "-dry-run", binary}, exitValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if got := run(tt.args, &stdout, &stderr); got != tt.want {
+				t.Fatalf("run(%v) = %d; want %d (stderr: %s)", tt.args, got, tt.want, stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunErrorPolicies(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		for _, answer := range []string{"alpha", "taken", "delta"} {
+			if bytes.Contains(body, []byte(answer)) {
+				w.Write([]byte(`{"message":{"role":"assistant","content":"` + answer + `"}}`))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":"boom"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	// The model chokes on b.txt, and c.txt's name is already taken.
+	tests := []struct {
+		modelErr, fsErr string
+		renamed         string
+		failed          string
+		want            int
+	}{
+		{"continue", "abort", "a", "b", exitFilesystem},
+		{"continue", "continue", "ad", "bc", exitModel},
+		{"abort", "abort", "a", "", exitModel},
+		{"abort", "continue", "a", "", exitModel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.modelErr+"/"+tt.fsErr, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			files := map[string]string{}
+			for name, content := range map[string]string{"a": "alpha", "b": "choke", "c": "taken", "d": "delta"} {
+				files[name] = writeFile(t, dir, name+".txt", []byte(content))
+			}
+			writeFile(t, dir, "taken.txt", []byte("existing"))
+
+			var stdout, stderr bytes.Buffer
+			args := []string{"-server", server.URL, "-on-model-error", tt.modelErr, "-on-fs-error", tt.fsErr, files["a"], files["b"], files["c"], files["d"]}
+			if got := run(args, &stdout, &stderr); got != tt.want {
+				t.Fatalf("run exit %d; want %d (stderr: %s)", got, tt.want, stderr.String())
+			}
+			for _, name := range []string{"a", "b", "c", "d"} {
+				renamed := strings.Contains(stdout.String(), files[name]+" -> ")
+				if want := strings.Contains(tt.renamed, name); renamed != want {
+					t.Fatalf("%s renamed: %v; want %v (stdout: %s)", name, renamed, want, stdout.String())
+				}
+				failed := strings.Contains(stderr.String(), "failed: "+files[name]+" ")
+				if want := strings.Contains(tt.failed, name); failed != want {
+					t.Fatalf("%s failed: %v; want %v (stderr: %s)", name, failed, want, stderr.String())
+				}
+			}
+		})
+	}
+
+	if _, _, _, _, err := parseArgs([]string{"-on-model-error", "skip", "file.txt"}); err == nil {
+		t.Fatalf("expected an unknown -on-model-error value to be rejected")
+	}
+}
+
+func TestRunNonJSONResponse(t *testing.T) {
+	t.Parallel()
+
+	// A proxy in front of the model answers b.txt with an HTML page.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if bytes.Contains(body, []byte("choke")) {
+			w.Write([]byte("<html>proxy</html>"))
+			return
+		}
+		w.Write([]byte(`{"message":{"role":"assistant","content":"alpha"}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	for _, policy := range []string{"abort", "continue"} {
+		dir := t.TempDir()
+		b := writeFile(t, dir, "b.txt", []byte("choke"))
+		c := writeFile(t, dir, "c.txt", []byte("other"))
+		var stdout, stderr bytes.Buffer
+		if code := run([]string{"-server", server.URL, "-on-model-error", policy, b, c}, &stdout, &stderr); code != exitModel {
+			t.Fatalf("%s: exit %d; want %d (stderr: %s)", policy, code, exitModel, stderr.String())
+		}
+		renamed := strings.Contains(stdout.String(), c+" -> ")
+		if want := policy == "continue"; renamed != want {
+			t.Fatalf("%s: c.txt renamed: %v; want %v (stdout: %s)", policy, renamed, want, stdout.String())
+		}
+	}
+}
+
+func TestRunRenames(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	src := writeFile(t, dir, "draft.txt", []byte("meeting notes"))
+	server := fakeOllama(t, http.StatusOK, "meeting_notes")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-server", server.URL, src}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+	dst := filepath.Join(dir, "meeting_notes.txt")
+	if stdout.String() != src+" -> "+dst+"\n" {
+		t.Fatalf("unexpected output: %q", stdout.String())
+	}
+	if _, err := os.Stat(dst); err != nil {
+		t.Fatalf("renamed file missing: %v", err)
+	}
+
+	stdout.Reset()
+	if code := run([]string{"-server", server.URL, dst}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+	if stdout.String() != "unchanged: "+dst+"\n" {
+		t.Fatalf("expected unchanged notice, got %q", stdout.String())
+	}
+}
+
+func TestRunShowRaw(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	src := writeFile(t, dir, "draft.txt", []byte("meeting notes"))
+	server := fakeOllama(t, http.StatusOK, "Meeting Notes")
+	dst := filepath.Join(dir, "meeting_notes.txt")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-server", server.URL, "-dry-run", "-show-raw", src}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+	if want := src + " -> " + dst + ` (raw: "Meeting Notes")` + "\n"; stdout.String() != want {
+		t.Fatalf("unexpected output: %q; want %q", stdout.String(), want)
+	}
+
+	stdout.Reset()
+	if code := run([]string{"-server", server.URL, "-dry-run", src}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+	if strings.Contains(stdout.String(), "raw:") {
+		t.Fatalf("raw output should be off by default: %q", stdout.String())
+	}
+}
+
+func TestRunOnCollisionSuffix(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	first := writeFile(t, dir, "a.txt", []byte("first report"))
+	second := writeFile(t, dir, "b.txt", []byte("second report"))
+	server := fakeOllama(t, http.StatusOK, "report")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-server", server.URL, "-jobs", "2", "-on-collision", "suffix", second, first}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+	want := first + " -> " + filepath.Join(dir, "report.txt") + "\n" + second + " -> " + filepath.Join(dir, "report_2.txt") + "\n"
+	if stdout.String() != want {
+		t.Fatalf("unexpected output: %q; want %q", stdout.String(), want)
+	}
+	for _, name := range []string{"report.txt", "report_2.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("renamed file missing: %v", err)
+		}
+	}
+
+	if _, _, _, _, err := parseArgs([]string{"-on-collision", "overwrite", "file.txt"}); err == nil {
+		t.Fatalf("expected error for unknown -on-collision")
+	}
+}
+
+func TestRunOnCollisionSuffixStable(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a.txt", []byte("first report"))
+	b := writeFile(t, dir, "b.txt", []byte("second report"))
+	c := writeFile(t, dir, "c.txt", []byte("third report"))
+	server := fakeOllama(t, http.StatusOK, "report")
+
+	want := a + " -> " + filepath.Join(dir, "report.txt") + "\n" +
+		b + " -> " + filepath.Join(dir, "report_2.txt") + "\n" +
+		c + " -> " + filepath.Join(dir, "report_3.txt") + "\n"
+	for _, args := range [][]string{{"-jobs", "1", a, b, c}, {"-jobs", "3", c, a, b}, {"-jobs", "2", b, c, a}} {
+		var stdout, stderr bytes.Buffer
+		args = append([]string{"-server", server.URL, "-dry-run", "-on-collision", "suffix"}, args...)
+		if code := run(args, &stdout, &stderr); code != exitOK {
+			t.Fatalf("run %v exit %d: %s", args, code, stderr.String())
+		}
+		if stdout.String() != want {
+			t.Fatalf("run %v output %q; want %q", args, stdout.String(), want)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-server", server.URL, "-on-collision", "suffix", a, b, c}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+
+	// Running again on the renamed files keeps every counter.
+	stdout.Reset()
+	renamed := []string{filepath.Join(dir, "report_3.txt"), filepath.Join(dir, "report.txt"), filepath.Join(dir, "report_2.txt")}
+	if code := run(append([]string{"-server", server.URL, "-on-collision", "suffix"}, renamed...), &stdout, &stderr); code != exitOK {
+		t.Fatalf("rerun exit %d: %s", code, stderr.String())
+	}
+	want = "unchanged: " + filepath.Join(dir, "report.txt") + "\n" +
+		"unchanged: " + filepath.Join(dir, "report_2.txt") + "\n" +
+		"unchanged: " + filepath.Join(dir, "report_3.txt") + "\n"
+	if stdout.String() != want {
+		t.Fatalf("rerun output %q; want %q", stdout.String(), want)
+	}
+}
+
+func TestRunOnAmbiguous(t *testing.T) {
+	t.Parallel()
+
+	server := fakeOllama(t, http.StatusOK, "__!__")
+	tests := []struct {
+		fallback string
+		want     *regexp.Regexp
+	}{
+		{"", regexp.MustCompile(`^unchanged: .*draft\.txt\n$`)},
+		{"keep", regexp.MustCompile(`^unchanged: .*draft\.txt\n$`)},
+		{"hash", regexp.MustCompile(`draft\.txt -> .*file_[0-9a-f]{6}\.txt\n$`)},
+		{"file", regexp.MustCompile(`draft\.txt -> .*file\.txt\n$`)},
+	}
+	for _, tt := range tests {
+		path := writeFile(t, t.TempDir(), "draft.txt", []byte("some notes"))
+		args := []string{"-server", server.URL, "-dry-run", "-prefix", "x_", path}
+		if tt.fallback != "" {
+			args = append([]string{"-on-ambiguous", tt.fallback}, args...)
+		}
+		var stdout, stderr bytes.Buffer
+		if code := run(args, &stdout, &stderr); code != exitOK {
+			t.Fatalf("%s: run exit %d: %s", tt.fallback, code, stderr.String())
+		}
+		if !tt.want.MatchString(stdout.String()) {
+			t.Fatalf("%s: unexpected output %q", tt.fallback, stdout.String())
+		}
+	}
+
+	if _, _, _, _, err := parseArgs([]string{"-on-ambiguous", "guess", "file.txt"}); err == nil {
+		t.Fatalf("expected error for unknown -on-ambiguous")
+	}
+}
+
+func TestRunValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{[]string{"-validate", "meeting_notes"}, exitOK, "valid: meeting_notes", ""},
+		{[]string{"-validate", "Meeting Notes"}, exitValidation, "", "would be sanitized to: meeting_notes"},
+		{[]string{"-validate", strings.Repeat("a", 31)}, exitValidation, "", "longer than 30 characters"},
+		{[]string{"-validate", ""}, exitValidation, "", "is empty"},
+		{[]string{"-allow-ext", "-validate", "report.csv"}, exitOK, "valid: report.csv", ""},
+		{[]string{"-no-extension-strip", "-validate", "Q3 Report"}, exitOK, "valid: Q3 Report", ""},
+	}
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		if code := run(tt.args, &stdout, &stderr); code != tt.code {
+			t.Fatalf("%v: exit %d; want %d (stderr %q)", tt.args, code, tt.code, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), tt.stdout) || !strings.Contains(stderr.String(), tt.stderr) {
+			t.Fatalf("%v: stdout %q, stderr %q", tt.args, stdout.String(), stderr.String())
+		}
+	}
+}
+
+func TestRunPreserveTree(t *testing.T) {
+	t.Parallel()
+
+	src := t.TempDir()
+	out := t.TempDir()
+	for _, sub := range []string{"a", filepath.Join("a", "b")} {
+		if err := os.MkdirAll(filepath.Join(src, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, src, "top.txt", []byte("top"))
+	writeFile(t, filepath.Join(src, "a"), "one.txt", []byte("one"))
+	writeFile(t, filepath.Join(src, "a", "b"), "two.md", []byte("two"))
+	server := fakeOllama(t, http.StatusOK, "notes")
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"-server", server.URL, "-recursive", "-dir", out, "-preserve-tree", src}
+	if code := run(args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+	for _, want := range []string{"notes.txt", filepath.Join("a", "notes.txt"), filepath.Join("a", "b", "notes.md")} {
+		if _, err := os.Stat(filepath.Join(out, want)); err != nil {
+			t.Fatalf("expected %s under -dir: %v", want, err)
+		}
+	}
+
+	if _, _, _, _, err := parseArgs([]string{"-preserve-tree", "file.txt"}); err == nil {
+		t.Fatalf("expected error for -preserve-tree without -dir")
+	}
+}
+
+func TestRunDedupe(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	first := writeFile(t, dir, "a.txt", []byte("scanned invoice"))
+	second := writeFile(t, dir, "b.txt", []byte("scanned invoice"))
+	third := writeFile(t, dir, "c.txt", []byte("scanned invoice"))
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"message":{"role":"assistant","content":"invoice"}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-server", server.URL, "-jobs", "3", "-dedupe", third, second, first}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected one model call for identical files, got %d", calls.Load())
+	}
+	want := first + " -> " + filepath.Join(dir, "invoice.txt") + "\n" +
+		second + " -> " + filepath.Join(dir, "invoice_2.txt") + "\n" +
+		third + " -> " + filepath.Join(dir, "invoice_3.txt") + "\n"
+	if stdout.String() != want {
+		t.Fatalf("unexpected output: %q; want %q", stdout.String(), want)
+	}
+	for _, dup := range []string{second, third} {
+		if !strings.Contains(stderr.String(), "duplicate: "+dup+" (same content as "+first+")") {
+			t.Fatalf("missing duplicate notice for %s: %q", dup, stderr.String())
+		}
+	}
+}
+
+func TestParseArgsLinkModesExclusive(t *testing.T) {
+	t.Parallel()
+
+	if _, _, _, _, err := parseArgs([]string{"-link", "-symlink", "file.txt"}); err == nil {
+		t.Fatalf("expected error combining -link and -symlink")
+	}
+}
+
+func TestParseArgsRequireDir(t *testing.T) {
+	t.Parallel()
+
+	for _, args := range [][]string{
+		{"-require-dir", "file.txt"},
+		{"-require-dir", "-dry-run", "file.txt"},
+		{"-require-dir", "-link", "file.txt"},
+	} {
+		if _, _, _, _, err := parseArgs(args); err == nil || !strings.Contains(err.Error(), "-require-dir") {
+			t.Fatalf("parseArgs(%v) error = %v; want a -require-dir error", args, err)
+		}
+	}
+	if _, _, _, _, err := parseArgs([]string{"-require-dir", "-dir", t.TempDir(), "file.txt"}); err != nil {
+		t.Fatalf("-require-dir with -dir: %v", err)
+	}
+	if _, _, _, _, err := parseArgs([]string{"-require-dir", "-validate", "good_name"}); err != nil {
+		t.Fatalf("-validate needs no -dir: %v", err)
+	}
+}
+
+func TestParseArgsModels(t *testing.T) {
+	t.Parallel()
+
+	opts, _, _, _, err := parseArgs([]string{"-models", "qwen2.5, llama3.2,,gemma3", "file.txt"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Model != "qwen2.5" || strings.Join(opts.FallbackModels, ",") != "llama3.2,gemma3" {
+		t.Fatalf("unexpected models: %q then %q", opts.Model, opts.FallbackModels)
+	}
+	if _, _, _, _, err := parseArgs([]string{"-model", "a", "-models", "b,c", "file.txt"}); err == nil {
+		t.Fatalf("expected error combining -model and -models")
+	}
+}
+
+func TestParseArgsSizeRange(t *testing.T) {
+	t.Parallel()
+
+	opts, _, _, _, err := parseArgs([]string{"-min-size", "1k", "-max-size", "10M", "file.txt"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.MinSize != 1024 || opts.MaxSize != 10<<20 {
+		t.Fatalf("unexpected sizes: min %d max %d", opts.MinSize, opts.MaxSize)
+	}
+	if _, _, _, _, err := parseArgs([]string{"-min-size", "2M", "-max-size", "1M", "file.txt"}); err == nil {
+		t.Fatalf("expected error when -min-size exceeds -max-size")
+	}
+	if _, _, _, _, err := parseArgs([]string{"-max-size", "big", "file.txt"}); err == nil {
+		t.Fatalf("expected error for an invalid size")
+	}
+}
+
+func TestParseArgsModelfile(t *testing.T) {
+	t.Parallel()
+
+	path := writeFile(t, t.TempDir(), "Modelfile", []byte("FROM x\nPARAMETER temperature 0.6\nPARAMETER top_p 0.8\n"))
+	opts, _, _, _, err := parseArgs([]string{"-modelfile", path, "-top_p", "0.5", "file.txt"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if opts.Temperature != 0.6 {
+		t.Fatalf("modelfile temperature not applied: %v", opts.Temperature)
+	}
+	if opts.TopP != 0.5 {
+		t.Fatalf("explicit -top_p should override the modelfile, got %v", opts.TopP)
+	}
+
+	if _, _, _, _, err := parseArgs([]string{"-modelfile", filepath.Join(t.TempDir(), "missing"), "file.txt"}); err == nil {
+		t.Fatalf("expected error for missing modelfile")
+	}
+}
+
+func TestRunNameOnly(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	src := writeFile(t, dir, "draft.txt", []byte("meeting notes"))
+	server := fakeOllama(t, http.StatusOK, "meeting_notes")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-server", server.URL, "-name-only", src}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+	if want := src + "\tmeeting_notes.txt\n"; stdout.String() != want {
+		t.Fatalf("unexpected output: %q; want %q", stdout.String(), want)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Fatalf("-name-only should not rename: %v", err)
+	}
+
+	for _, other := range []string{"-json", "-json-stream", "-apply-on-confirm"} {
+		if _, _, _, _, err := parseArgs([]string{"-name-only", other, src}); err == nil {
+			t.Fatalf("expected error combining -name-only and %s", other)
+		}
+	}
+}
+
+func TestRunCompareToExisting(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	bad := writeFile(t, dir, "untitled.txt", []byte("meeting notes"))
+	good := writeFile(t, dir, "agenda.txt", []byte("meeting notes"))
+	server := fakeOllama(t, http.StatusOK, "meeting_notes")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-server", server.URL, "-compare-to-existing", bad, good}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "meeting_notes.txt")); err != nil {
+		t.Fatalf("bad name was not renamed: %v", err)
+	}
+	if _, err := os.Stat(good); err != nil {
+		t.Fatalf("good name should be left alone: %v", err)
+	}
+	if !strings.Contains(stderr.String(), "skipped: "+good) {
+		t.Fatalf("missing skipped notice: %q", stderr.String())
+	}
+
+	if _, _, _, _, err := parseArgs([]string{"-compare-to-existing", "-bad-name-pattern", "(", bad}); err == nil {
+		t.Fatal("expected error for an invalid -bad-name-pattern")
+	}
+}
+
+func TestRunAbortOnRepeatedNames(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	var files []string
+	for i, text := range []string{"invoice", "recipe", "poem", "letter"} {
+		files = append(files, writeFile(t, dir, fmt.Sprintf("%d.txt", i), []byte(text)))
+	}
+	server := fakeOllama(t, http.StatusOK, "document")
+
+	var stdout, stderr bytes.Buffer
+	args := append([]string{"-server", server.URL, "-dry-run", "-abort-on-repeated-names", "3"}, files...)
+	if code := run(args, &stdout, &stderr); code != exitModel {
+		t.Fatalf("run exit %d; want %d: %s", code, exitModel, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "may be misconfigured") {
+		t.Fatalf("expected a misconfiguration warning, got %q", stderr.String())
+	}
+	if lines := strings.Count(stdout.String(), "\n"); lines != 2 {
+		t.Fatalf("expected the 2 files before the streak to be printed, got %q", stdout.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	args = append([]string{"-server", server.URL, "-dry-run", "-on-collision", "suffix"}, files...)
+	if code := run(args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("the check should be off by default, exit %d: %s", code, stderr.String())
+	}
+
+	for _, bad := range []string{"-1", "1"} {
+		if _, _, _, _, err := parseArgs([]string{"-abort-on-repeated-names", bad, "a.txt"}); err == nil {
+			t.Fatalf("expected error for -abort-on-repeated-names %s", bad)
+		}
+	}
+}
+
+func TestRunSidecar(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	src := writeFile(t, dir, "draft.txt", []byte("meeting notes"))
+	server := fakeOllama(t, http.StatusOK, "meeting_notes")
+
+	var stdout, stderr bytes.Buffer
+	for i := 0; i < 2; i++ {
+		// The second run must not name the sidecar written by the first.
+		if code := run([]string{"-server", server.URL, "-sidecar", "-recursive", dir}, &stdout, &stderr); code != exitOK {
+			t.Fatalf("run exit %d: %s", code, stderr.String())
+		}
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Fatalf("-sidecar should not rename: %v", err)
+	}
+	data, err := os.ReadFile(src + ".naduke")
+	if err != nil {
+		t.Fatalf("read sidecar: %v", err)
+	}
+	if string(data) != "meeting_notes.txt\n" {
+		t.Fatalf("unexpected sidecar content: %q", data)
+	}
+	want := src + " -> " + filepath.Join(dir, "meeting_notes.txt") + " (in " + src + ".naduke)\n"
+	if stdout.String() != want+want {
+		t.Fatalf("unexpected output: %q", stdout.String())
+	}
+
+	if _, _, _, _, err := parseArgs([]string{"-sidecar", "-link", src}); err == nil {
+		t.Fatalf("expected error combining -sidecar and -link")
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		files = append(files, writeFile(t, dir, name, []byte("meeting notes")))
+	}
+	// The first answer is quick; the next one never comes.
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		if requests.Add(1) > 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+			return
+		}
+		w.Write([]byte(`{"message":{"role":"assistant","content":"meeting_notes"}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	start := time.Now()
+	var stdout, stderr bytes.Buffer
+	args := append([]string{"-server", server.URL, "-jobs", "1", "-run-timeout", "200ms"}, files...)
+	if code := run(args, &stdout, &stderr); code != exitTimedOut {
+		t.Fatalf("run exit %d, want %d: %s", code, exitTimedOut, stderr.String())
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("run took %s; the timeout should cancel the request in flight", elapsed)
+	}
+	if !strings.Contains(stderr.String(), "Timed out: 1 of 3 file(s) completed within 200ms") {
+		t.Fatalf("stderr lacks the summary: %q", stderr.String())
+	}
+	for _, name := range []string{"meeting_notes.txt", "b.txt", "c.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("%s should exist: %v", name, err)
+		}
+	}
+
+	// A Retry-After wait is cut short too.
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Header().Set("Retry-After", "8")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(limited.Close)
+	start = time.Now()
+	stderr.Reset()
+	args = []string{"-server", limited.URL, "-http-retries", "3", "-run-timeout", "200ms", filepath.Join(dir, "b.txt")}
+	if code := run(args, &stdout, &stderr); code != exitTimedOut {
+		t.Fatalf("run exit %d, want %d: %s", code, exitTimedOut, stderr.String())
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("run took %s; the timeout should end the Retry-After wait", elapsed)
+	}
+
+	if _, _, _, _, err := parseArgs([]string{"-run-timeout", "-1s", "a.txt"}); err == nil {
+		t.Fatalf("expected error for negative -run-timeout")
+	}
+}
+
+func TestRunCheck(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	named := writeFile(t, dir, "meeting_notes.txt", []byte("meeting notes"))
+	server := fakeOllama(t, http.StatusOK, "meeting_notes")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-server", server.URL, "-check", named}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d; want %d: %s", code, exitOK, stderr.String())
+	}
+
+	draft := writeFile(t, dir, "draft.txt", []byte("meeting notes"))
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"-server", server.URL, "-check", draft}, &stdout, &stderr); code != exitChanged {
+		t.Fatalf("run exit %d; want %d: %s", code, exitChanged, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "check: 1 of 1 file(s) would be renamed") {
+		t.Fatalf("missing check summary: %q", stderr.String())
+	}
+	if _, err := os.Stat(draft); err != nil {
+		t.Fatalf("-check should not rename: %v", err)
+	}
+
+	failing := fakeOllama(t, http.StatusInternalServerError, "")
+	if code := run([]string{"-server", failing.URL, "-check", named}, &stdout, &stderr); code != exitModel {
+		t.Fatalf("run exit %d; want %d for a failed file", code, exitModel)
+	}
+}
+
+func TestRunPrintURL(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	src := writeFile(t, dir, "draft.txt", []byte("meeting notes"))
+	server := fakeOllama(t, http.StatusOK, "meeting_notes")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-server", server.URL, "-print-url", "-dry-run", src}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+	if want := "url: " + server.URL + "/api/chat\n"; !strings.HasPrefix(stderr.String(), want) {
+		t.Fatalf("stderr = %q; want it to start with %q", stderr.String(), want)
+	}
+}
+
+func TestRunContentSource(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	// An ID3v2.3 tag with a TIT2 frame, then an MPEG frame header.
+	tag := append([]byte("ID3\x03\x00\x00\x00\x00\x00\x16TIT2\x00\x00\x00\x0c\x00\x00\x00Night Drive"), 0xff, 0xfb, 0x90, 0x00)
+	song := writeFile(t, dir, "track01.mp3", tag)
+	note := writeFile(t, dir, "draft.txt", []byte("meeting notes"))
+	server := fakeOllama(t, http.StatusOK, "night_drive")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-server", server.URL, "-content-source", "metadata", song, note}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+	if want := song + " -> " + filepath.Join(dir, "night_drive.mp3") + "\n"; stdout.String() != want {
+		t.Fatalf("stdout = %q; want %q", stdout.String(), want)
+	}
+	if want := "skipped: " + note + " (no metadata)\n"; stderr.String() != want {
+		t.Fatalf("stderr = %q; want %q", stderr.String(), want)
+	}
+
+	if _, _, _, _, err := parseArgs([]string{"-content-source", "exif", "a.txt"}); err == nil {
+		t.Fatalf("expected an unknown -content-source to be rejected")
+	}
+}
+
+func TestRunOnEmpty(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		strategy string
+		code     int
+		want     string // file left in the directory
+		stderr   string
+	}{
+		{naduke.EmptyAsk, exitOK, "meeting_notes.txt", ""},
+		{naduke.EmptySkip, exitOK, "draft.txt", "skipped: "},
+		{naduke.EmptyNameDefault, exitOK, "nothing_here.txt", ""},
+		{naduke.EmptyError, exitValidation, "draft.txt", "empty sample"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			src := writeFile(t, dir, "draft.txt", nil)
+			server := fakeOllama(t, http.StatusOK, "meeting_notes")
+
+			var stdout, stderr bytes.Buffer
+			args := []string{"-server", server.URL, "-on-empty", tt.strategy, "-empty-name", "nothing_here", src}
+			if code := run(args, &stdout, &stderr); code != tt.code {
+				t.Fatalf("run exit %d; want %d: %s", code, tt.code, stderr.String())
+			}
+			if _, err := os.Stat(filepath.Join(dir, tt.want)); err != nil {
+				t.Fatalf("expected %s: %v", tt.want, err)
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) {
+				t.Fatalf("stderr = %q; want it to contain %q", stderr.String(), tt.stderr)
+			}
+		})
+	}
+
+	if _, _, _, _, err := parseArgs([]string{"-on-empty", "ignore", "file.txt"}); err == nil {
+		t.Fatal("expected error for an unknown -on-empty strategy")
+	}
+	if _, _, _, _, err := parseArgs([]string{"-on-empty", "name-default", "-empty-name", "Empty File", "file.txt"}); err == nil {
+		t.Fatal("expected error for an invalid -empty-name")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/takai/naduke/internal/naduke"
+)
+
+// stdin is where -stdin-name-list reads its mapping; tests replace it.
+var stdin io.Reader = os.Stdin
+
+// nameList is a -stdin-name-list mapping of source paths to names, reviewed
+// elsewhere and applied without asking the model.
+type nameList struct {
+	// files lists the sources in input order.
+	files []string
+	names map[string]string
+}
+
+// readNameList parses a -stdin-name-list mapping: one SOURCE<TAB>NAME pair
+// per line or, when the input contains a NUL byte, SOURCE and NAME as
+// alternating NUL-terminated fields, so paths may hold tabs and newlines.
+// Blank lines are ignored; a source listed twice is an error.
+func readNameList(r io.Reader) (nameList, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nameList{}, fmt.Errorf("read name list: %w", err)
+	}
+
+	var pairs [][2]string
+	if bytes.IndexByte(data, 0) >= 0 {
+		fields := strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00")
+		if len(fields)%2 != 0 {
+			return nameList{}, fmt.Errorf("name list: %s has no name (want SOURCE\\0NAME\\0 pairs)", fields[len(fields)-1])
+		}
+		for i := 0; i < len(fields); i += 2 {
+			pairs = append(pairs, [2]string{fields[i], fields[i+1]})
+		}
+	} else {
+		for i, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSuffix(line, "\r")
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			source, name, ok := strings.Cut(line, "\t")
+			if !ok {
+				return nameList{}, fmt.Errorf("name list line %d: want SOURCE<TAB>NAME, got %q", i+1, line)
+			}
+			pairs = append(pairs, [2]string{source, name})
+		}
+	}
+
+	list := nameList{names: make(map[string]string, len(pairs))}
+	for _, pair := range pairs {
+		source, name := pair[0], pair[1]
+		if source == "" {
+			return nameList{}, fmt.Errorf("name list: empty source for name %q", name)
+		}
+		if _, dup := list.names[source]; dup {
+			return nameList{}, fmt.Errorf("name list: %s listed twice", source)
+		}
+		list.files = append(list.files, source)
+		list.names[source] = name
+	}
+	return list, nil
+}
+
+// SuggestName returns the name listed for path. It must already pass the
+// naming rules, as with -validate: sanitizing it would apply a name other
+// than the one reviewed. Without -allow-ext, path's own extension is dropped
+// from the name, as -name-only prints it, since it is appended again.
+func (l nameList) SuggestName(opts naduke.Options, path, _ string) (string, error) {
+	name, ok := l.names[path]
+	if !ok {
+		return "", fmt.Errorf("%w: no name for %s in the name list", naduke.ErrInvalidSuggestion, path)
+	}
+	if ext := naduke.Ext(path); ext != "" && !opts.AllowExt {
+		name = strings.TrimSuffix(name, ext)
+	}
+	if _, err := naduke.ValidateFor(opts, name); err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return name, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadNameList(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		input   string
+		files   []string
+		names   map[string]string
+		wantErr bool
+	}{
+		{"tab", "a.txt\tmeeting_notes\n\nb c.txt\tinvoice\r\n", []string{"a.txt", "b c.txt"}, map[string]string{"a.txt": "meeting_notes", "b c.txt": "invoice"}, false},
+		{"nul", "a\tb.txt\x00meeting_notes\x00new\nline.txt\x00invoice\x00", []string{"a\tb.txt", "new\nline.txt"}, map[string]string{"a\tb.txt": "meeting_notes", "new\nline.txt": "invoice"}, false},
+		{"empty", "", nil, map[string]string{}, false},
+		{"no tab", "a.txt meeting_notes\n", nil, nil, true},
+		{"odd nul fields", "a.txt\x00meeting_notes\x00b.txt\x00", nil, nil, true},
+		{"duplicate", "a.txt\tone\na.txt\ttwo\n", nil, nil, true},
+		{"empty source", "\tmeeting_notes\n", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := readNameList(strings.NewReader(tt.input))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("readNameList(%q) should fail", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readNameList error: %v", err)
+			}
+			if !reflect.DeepEqual(list.files, tt.files) || !reflect.DeepEqual(list.names, tt.names) {
+				t.Fatalf("readNameList = %q, %q; want %q, %q", list.files, list.names, tt.files, tt.names)
+			}
+		})
+	}
+}
+
+// TestRunStdinNameList replaces stdin, so it does not run in parallel.
+func TestRunStdinNameList(t *testing.T) {
+	// The model fails every request, so only the list can name the files.
+	server := fakeOllama(t, http.StatusInternalServerError, "")
+
+	for _, sep := range []struct{ name, field, pair string }{{"tab", "\t", "\n"}, {"nul", "\x00", "\x00"}} {
+		t.Run(sep.name, func(t *testing.T) {
+			dir := t.TempDir()
+			a := writeFile(t, dir, "a.txt", []byte("first report"))
+			b := writeFile(t, dir, "b.txt", []byte("second report"))
+			stdin = strings.NewReader(a + sep.field + "report" + sep.pair + b + sep.field + "report.txt" + sep.pair)
+			t.Cleanup(func() { stdin = os.Stdin })
+
+			var stdout, stderr bytes.Buffer
+			if code := run([]string{"-server", server.URL, "-stdin-name-list", "-on-collision", "suffix"}, &stdout, &stderr); code != exitOK {
+				t.Fatalf("run exit %d: %s", code, stderr.String())
+			}
+			want := a + " -> " + filepath.Join(dir, "report.txt") + "\n" + b + " -> " + filepath.Join(dir, "report_2.txt") + "\n"
+			if stdout.String() != want {
+				t.Fatalf("output %q; want %q", stdout.String(), want)
+			}
+		})
+	}
+
+	// Binary and empty files are named without reading them.
+	t.Cleanup(func() { stdin = os.Stdin })
+	dir := t.TempDir()
+	image := writeFile(t, dir, "img.png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	empty := writeFile(t, dir, "empty.txt", nil)
+	stdin = strings.NewReader(image + "\tbeach_photo\n" + empty + "\tplaceholder\n")
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-server", server.URL, "-stdin-name-list", "-on-empty", "error", "-entropy-threshold", "1"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+	for _, name := range []string{"beach_photo.png", "placeholder.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("%s should exist: %v", name, err)
+		}
+	}
+
+	stdin = strings.NewReader(filepath.Join(dir, "missing.txt") + "\tnotes\n")
+	stderr.Reset()
+	if code := run([]string{"-server", server.URL, "-stdin-name-list"}, &stdout, &stderr); code != exitFilesystem {
+		t.Fatalf("missing source: exit %d, want %d: %s", code, exitFilesystem, stderr.String())
+	}
+
+	src := writeFile(t, dir, "a.txt", []byte("first report"))
+	stdin = strings.NewReader(src + "\tMeeting Notes\n")
+	stderr.Reset()
+	if code := run([]string{"-server", server.URL, "-stdin-name-list"}, &stdout, &stderr); code != exitValidation {
+		t.Fatalf("invalid listed name: exit %d, want %d: %s", code, exitValidation, stderr.String())
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Fatalf("file with an invalid name should stay: %v", err)
+	}
+
+	for _, args := range [][]string{{"-stdin-name-list", "a.txt"}, {"-stdin-name-list", "-recursive"}, {"-stdin-name-list", "-hash-source", "sample"}} {
+		if _, _, _, _, err := parseArgs(args); err == nil {
+			t.Fatalf("parseArgs(%q) should fail", args)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/takai/naduke/internal/naduke"
+)
+
+// suggester is the part of the naduke client used to name files.
+type suggester interface {
+	SuggestName(opts naduke.Options, path, content string) (string, error)
+}
+
+// planEntry is the outcome of naming one file, kept so a dry run can be
+// applied later without asking the model again.
+type planEntry struct {
+	Source      string
+	Name        string
+	Destination string
+	Unchanged   bool
+	// Raw is the model's answer before sanitization.
+	Raw string
+	// DuplicateOf is the representative whose name a -dedupe duplicate
+	// shares.
+	DuplicateOf string
+	// sample is the text sent to the model, kept for -hash-source sample.
+	sample string
+	// emptyName marks an empty file named -empty-name without the model.
+	emptyName bool
+}
+
+// readText reads the sample sent to the model for path. An empty file gives
+// an empty sample rather than an error.
+func readText(opts naduke.Options, path string) (string, error) {
+	sample, err := naduke.ReadSample(path, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.LenientUTF8 {
+		sample = naduke.RepairUTF8(sample, path)
+	}
+	if opts.TrimNameFromContent {
+		sample = naduke.TrimLeadingName(sample, path)
+	}
+	text, err := naduke.EnsureTextSample(sample, path)
+	if err != nil && !errors.Is(err, naduke.ErrEmptySample) {
+		return "", err
+	}
+	return text, nil
+}
+
+// planFile reads path, asks the model for a name and works out where the
+// file would go. It does not touch the filesystem.
+func planFile(client suggester, opts naduke.Options, path string) (planEntry, error) {
+	if strings.TrimSpace(path) == "" {
+		return planEntry{}, errEmptyPath
+	}
+	if opts.StdinNameList {
+		// The name was reviewed already; the content is never read.
+		if _, err := os.Stat(path); err != nil {
+			return planEntry{}, fmt.Errorf("open file: %w", err)
+		}
+		rawName, err := client.SuggestName(opts, path, "")
+		if err != nil {
+			return planEntry{}, err
+		}
+		return nameEntry(opts, planEntry{Source: path, Raw: rawName})
+	}
+
+	text, err := readText(opts, path)
+	if err != nil {
+		return planEntry{}, err
+	}
+
+	if representative, ok := opts.DuplicateOf[path]; ok {
+		// Named from the representative's answer once it is in the plan.
+		return planEntry{Source: path, DuplicateOf: representative, sample: text}, nil
+	}
+
+	if text == "" {
+		switch opts.OnEmpty {
+		case naduke.EmptyError:
+			return planEntry{}, fmt.Errorf("%w: %s is empty", naduke.ErrEmptySample, path)
+		case naduke.EmptyNameDefault:
+			return nameEntry(opts, planEntry{Source: path, Raw: opts.EmptyName, emptyName: true})
+		}
+	}
+
+	rawName, err := client.SuggestName(opts, path, text)
+	if err != nil {
+		return planEntry{}, err
+	}
+	entry := planEntry{Source: path, Raw: rawName, sample: text}
+	return nameEntry(opts, entry)
+}
+
+// nameEntry turns entry.Raw into the file name and destination for
+// entry.Source.
+func nameEntry(opts naduke.Options, entry planEntry) (planEntry, error) {
+	newName := naduke.SanitizeSuggestion(entry.Raw, opts)
+	verbatim := false
+	if naduke.IsFallbackName(newName, opts) {
+		var err error
+		newName, verbatim, err = naduke.AmbiguousName(entry.Source, newName, entry.sample, opts)
+		if err != nil {
+			return planEntry{}, err
+		}
+	}
+	entry.Name = newName
+	if !verbatim {
+		newName = naduke.ApplyPrefix(opts.Prefix, newName)
+		entry.Name = naduke.ApplyDatePrefix(naduke.DatePrefix(entry.Source, opts), newName)
+	}
+	destination, err := naduke.DestinationPath(entry.Source, entry.Name, opts)
+	if err != nil {
+		return planEntry{}, err
+	}
+	entry.Destination = destination
+
+	same, err := naduke.SamePath(entry.Source, entry.Destination)
+	if err != nil {
+		return planEntry{}, err
+	}
+	entry.Unchanged = same
+	return entry, nil
+}
+
+// planResult carries one worker's outcome back to the consumer.
+type planResult struct {
+	index int
+	entry planEntry
+	err   error
+}
+
+// buildPlan names files using opts.Jobs concurrent workers. Results flow
+// through a single consumer that passes each entry to handle in the order of
+// files, buffering those that finish early, so output never interleaves or
+// reorders whatever -jobs is. A failure, in planning or in handle, that
+// -on-model-error or -on-fs-error lets the run continue past is passed to fail
+// in the same order and the file is left out of the plan. After any other
+// failure no new files are started, and only the entries before the first
+// failing file are returned, together with its error. With
+// -abort-on-repeated-names N, the run stops the same way at the Nth file in a
+// row the model gave the same name, whatever -on-model-error says. Canceling
+// ctx also stops new files from starting while those in progress finish.
+// handle and fail may be nil.
+func buildPlan(ctx context.Context, client suggester, opts naduke.Options, files []string, handle func(planEntry) error, fail func(path string, err error)) ([]planEntry, error) {
+	jobs := opts.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	next := make(chan int)
+	results := make(chan planResult)
+	var wg sync.WaitGroup
+	var failed atomic.Bool
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				entry, err := planFile(client, opts, files[i])
+				if err != nil && !continueAfter(opts, err) {
+					failed.Store(true)
+				}
+				results <- planResult{index: i, entry: entry, err: err}
+			}
+		}()
+	}
+	go func() {
+	schedule:
+		for i := 0; i < len(files) && !failed.Load() && ctx.Err() == nil; i++ {
+			select {
+			case next <- i:
+			case <-ctx.Done():
+				break schedule
+			}
+		}
+		close(next)
+		wg.Wait()
+		close(results)
+	}()
+
+	var entries []planEntry
+	var firstErr error
+	pending := make(map[int]planResult)
+	claimed := make(map[string]bool)
+	answers := make(map[string]string)
+	skipped := make(map[string]error)
+	repeated, streak := "", 0
+	done := 0
+	for result := range results {
+		pending[result.index] = result
+		for firstErr == nil {
+			ready, ok := pending[done]
+			if !ok {
+				break
+			}
+			delete(pending, ready.index)
+			done++
+			if err, ok := skipped[ready.entry.DuplicateOf]; ok && ready.err == nil {
+				// A duplicate has no name of its own to fall back on.
+				ready.err = err
+			}
+			if ready.err == nil && ready.entry.DuplicateOf != "" {
+				// Representatives sort first, so their answer is already known.
+				ready.entry.Raw = answers[ready.entry.DuplicateOf]
+				ready.entry, ready.err = nameEntry(opts, ready.entry)
+			}
+			if ready.err == nil && opts.RepeatedNameLimit > 0 && ready.entry.DuplicateOf == "" && !ready.entry.emptyName {
+				// Duplicates share their representative's name by design,
+				// and empty files the -empty-name.
+				name := naduke.SanitizeSuggestion(ready.entry.Raw, opts)
+				if name == repeated {
+					streak++
+				} else {
+					repeated, streak = name, 1
+				}
+				if streak >= opts.RepeatedNameLimit {
+					firstErr = fmt.Errorf("%w: %q for %d files in a row; the model may be misconfigured", naduke.ErrRepeatedNames, name, streak)
+					failed.Store(true)
+					break
+				}
+			}
+			if ready.err == nil {
+				answers[ready.entry.Source] = ready.entry.Raw
+				ready.entry, ready.err = resolveCollision(opts, ready.entry, claimed)
+			}
+			if ready.err == nil && handle != nil {
+				ready.err = handle(ready.entry)
+			}
+			if ready.err != nil && continueAfter(opts, ready.err) {
+				skipped[files[ready.index]] = ready.err
+				if fail != nil {
+					fail(files[ready.index], ready.err)
+				}
+				continue
+			}
+			if ready.err != nil {
+				firstErr = ready.err
+				failed.Store(true)
+				break
+			}
+			entries = append(entries, ready.entry)
+		}
+	}
+	return entries, firstErr
+}
+
+// continueAfter reports whether the run goes on past err on a single file
+// under -on-model-error and -on-fs-error. Cancellation always stops it.
+func continueAfter(opts naduke.Options, err error) bool {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return false
+	case naduke.IsModelError(err):
+		return opts.OnModelError == naduke.ErrorContinue
+	case naduke.IsFilesystemError(err):
+		return opts.OnFSError == naduke.ErrorContinue
+	default:
+		return false
+	}
+}
+
+// resolveCollision applies -on-collision to entry. Files are resolved in
+// order, so a destination is taken if it exists on disk or an earlier entry
+// in the batch claimed it, and counters do not depend on which worker
+// finished first. Duplicates always get a counter, since they share their
+// representative's name.
+func resolveCollision(opts naduke.Options, entry planEntry, claimed map[string]bool) (planEntry, error) {
+	if entry.Unchanged {
+		claimed[entry.Destination] = true
+		return entry, nil
+	}
+	if entry.DuplicateOf != "" {
+		opts.OnCollision = naduke.CollisionSuffix
+	}
+	taken := func(destination string) bool {
+		if claimed[destination] {
+			return true
+		}
+		if same, _ := naduke.SamePath(entry.Source, destination); same {
+			// A counter that leads back to the file's own name is free.
+			return false
+		}
+		_, err := os.Lstat(destination)
+		return err == nil
+	}
+	name, err := naduke.ResolveCollision(entry.Source, entry.Name, entry.sample, opts, taken)
+	if err != nil {
+		return planEntry{}, err
+	}
+	if name != entry.Name {
+		entry.Name = name
+		if entry.Destination, err = naduke.DestinationPath(entry.Source, name, opts); err != nil {
+			return planEntry{}, err
+		}
+		if entry.Unchanged, err = naduke.SamePath(entry.Source, entry.Destination); err != nil {
+			return planEntry{}, err
+		}
+	}
+	claimed[entry.Destination] = true
+	return entry, nil
+}
+
+// applyEntry performs the rename recorded in entry, or with -sidecar writes
+// the new name to the file's sidecar instead.
+func applyEntry(opts naduke.Options, entry planEntry) error {
+	if opts.Sidecar {
+		return naduke.WriteSidecar(entry.Source, filepath.Base(entry.Destination))
+	}
+	if entry.Unchanged {
+		return nil
+	}
+	return naduke.RenameFile(entry.Source, entry.Name, opts)
+}
+
+// applyPlan applies every entry in order, stopping at the first failure.
+func applyPlan(opts naduke.Options, plan []planEntry, stdout io.Writer) error {
+	for _, entry := range plan {
+		if entry.Unchanged {
+			continue
+		}
+		if err := applyEntry(opts, entry); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "renamed: %s -> %s\n", entry.Source, entry.Destination)
+	}
+	return nil
+}
+
+// jsonSchemaVersion is the schema_version of -json and -json-stream
+// objects. Bump it whenever a field is removed, renamed or changes meaning;
+// adding a field is not a breaking change.
+const jsonSchemaVersion = 1
+
+// jsonEntry is the -json and -json-stream form of a planEntry.
+type jsonEntry struct {
+	SchemaVersion int    `json:"schema_version"`
+	Version       string `json:"naduke_version"`
+	Source        string `json:"source"`
+	Destination   string `json:"destination"`
+	Name          string `json:"name"`
+	Unchanged     bool   `json:"unchanged"`
+	DryRun        bool   `json:"dry_run"`
+	Raw           string `json:"raw"`
+	DuplicateOf   string `json:"duplicate_of,omitempty"`
+}
+
+func toJSON(opts naduke.Options, entry planEntry) jsonEntry {
+	return jsonEntry{
+		SchemaVersion: jsonSchemaVersion,
+		Version:       toolVersion(),
+		Source:        entry.Source,
+		Destination:   entry.Destination,
+		Name:          entry.Name,
+		Unchanged:     entry.Unchanged,
+		DryRun:        opts.DryRun,
+		Raw:           entry.Raw,
+		DuplicateOf:   entry.DuplicateOf,
+	}
+}
+
+// printPlanJSON writes the -json array of every entry.
+func printPlanJSON(w io.Writer, opts naduke.Options, plan []planEntry) error {
+	entries := make([]jsonEntry, 0, len(plan))
+	for _, entry := range plan {
+		entries = append(entries, toJSON(opts, entry))
+	}
+	return jsonEncoder(w, opts).Encode(entries)
+}
+
+// jsonEncoder returns an encoder for w that writes compact JSON, or indented
+// JSON with -json-pretty.
+func jsonEncoder(w io.Writer, opts naduke.Options) *json.Encoder {
+	enc := json.NewEncoder(w)
+	if opts.JSONPretty {
+		enc.SetIndent("", "  ")
+	}
+	return enc
+}
+
+// printEntry prints the outcome for one file. With -show-raw, a dry run also
+// shows the model's answer before sanitization. With -json-stream each entry
+// is one JSON object on its own line, or indented over several with
+// -json-pretty; with -json nothing is printed until printPlanJSON. With
+// -name-only the line is the source and the new file name, separated by a
+// tab.
+func printEntry(w io.Writer, opts naduke.Options, entry planEntry) {
+	switch {
+	case opts.NameOnly:
+		fmt.Fprintf(w, "%s\t%s\n", entry.Source, filepath.Base(entry.Destination))
+		return
+	case opts.JSONStream:
+		// Encode writes the whole object in one call, so it is complete as
+		// soon as the file is done.
+		jsonEncoder(w, opts).Encode(toJSON(opts, entry))
+		return
+	case opts.JSON:
+		return
+	}
+	raw := ""
+	if opts.ShowRaw && opts.DryRun {
+		raw = fmt.Sprintf(" (raw: %q)", entry.Raw)
+	}
+	if opts.Sidecar && !opts.DryRun {
+		raw += fmt.Sprintf(" (in %s)", naduke.SidecarPath(entry.Source))
+	}
+	if entry.Unchanged {
+		fmt.Fprintf(w, "unchanged: %s%s\n", entry.Source, raw)
+		return
+	}
+	fmt.Fprintf(w, "%s -> %s%s\n", entry.Source, entry.Destination, raw)
+}
+
+// offerApply asks whether to apply a dry-run plan. Only interactive sessions
+// are asked; -yes accepts without asking.
+func offerApply(in io.Reader, out io.Writer, interactive bool, opts naduke.Options, plan []planEntry) bool {
+	changes := 0
+	for _, entry := range plan {
+		if !entry.Unchanged {
+			changes++
+		}
+	}
+	if !interactive || changes == 0 {
+		return false
+	}
+	if opts.Yes {
+		return true
+	}
+	return confirmEnter(in, out, fmt.Sprintf("Apply %d rename(s) shown above?", changes))
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/takai/naduke/internal/naduke"
+)
+
+// countingSuggester returns canned names and counts model calls.
+type countingSuggester struct {
+	names map[string]string
+	calls int
+}
+
+func (s *countingSuggester) SuggestName(opts naduke.Options, path, content string) (string, error) {
+	s.calls++
+	return s.names[filepath.Base(path)], nil
+}
+
+func TestPlanThenApplyReusesSuggestions(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	first := writeFile(t, dir, "a.txt", []byte("alpha"))
+	second := writeFile(t, dir, "b.txt", []byte("beta"))
+	kept := writeFile(t, dir, "gamma.txt", []byte("gamma"))
+	client := &countingSuggester{names: map[string]string{"a.txt": "alpha", "b.txt": "beta", "gamma.txt": "gamma"}}
+
+	opts := naduke.Options{DryRun: true}
+	var plan []planEntry
+	for _, path := range []string{first, second, kept} {
+		entry, err := planFile(client, opts, path)
+		if err != nil {
+			t.Fatalf("planFile(%s): %v", path, err)
+		}
+		plan = append(plan, entry)
+	}
+	if _, err := os.Stat(first); err != nil {
+		t.Fatalf("planning must not rename: %v", err)
+	}
+	if !plan[2].Unchanged {
+		t.Fatalf("gamma.txt already has its suggested name")
+	}
+
+	var out bytes.Buffer
+	if err := applyPlan(opts, plan, &out); err != nil {
+		t.Fatalf("applyPlan: %v", err)
+	}
+	if client.calls != 3 {
+		t.Fatalf("applying must not query the model again, got %d calls", client.calls)
+	}
+	for _, name := range []string{"alpha.txt", "beta.txt", "gamma.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("%s missing after apply: %v", name, err)
+		}
+	}
+	if strings.Count(out.String(), "renamed: ") != 2 {
+		t.Fatalf("expected two applied renames, got %q", out.String())
+	}
+}
+
+func TestOfferApply(t *testing.T) {
+	t.Parallel()
+
+	plan := []planEntry{{Source: "a.txt", Destination: "alpha.txt"}}
+	unchanged := []planEntry{{Source: "a.txt", Unchanged: true}}
+
+	tests := []struct {
+		name        string
+		input       string
+		interactive bool
+		yes         bool
+		plan        []planEntry
+		want        bool
+	}{
+		{"enter applies", "\n", true, false, plan, true},
+		{"y applies", "y\n", true, false, plan, true},
+		{"n cancels", "n\n", true, false, plan, false},
+		{"eof cancels", "", true, false, plan, false},
+		{"non-interactive previews only", "\n", false, false, plan, false},
+		{"yes skips the prompt", "", true, true, plan, true},
+		{"nothing to apply", "\n", true, false, unchanged, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			got := offerApply(strings.NewReader(tt.input), &out, tt.interactive, naduke.Options{Yes: tt.yes}, tt.plan)
+			if got != tt.want {
+				t.Fatalf("offerApply = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// slowSuggester answers later for files earlier in the list, so concurrent
+// workers finish in reverse order.
+type slowSuggester struct {
+	delays map[string]time.Duration
+}
+
+func (s *slowSuggester) SuggestName(opts naduke.Options, path, content string) (string, error) {
+	time.Sleep(s.delays[filepath.Base(path)])
+	return "named_" + strings.TrimSuffix(filepath.Base(path), ".txt"), nil
+}
+
+func TestBuildPlanKeepsFileOrder(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	client := &slowSuggester{delays: map[string]time.Duration{}}
+	var files []string
+	for i, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		files = append(files, writeFile(t, dir, name, []byte(name)))
+		client.delays[name] = time.Duration(4-i) * 10 * time.Millisecond
+	}
+
+	plan, err := buildPlan(context.Background(), client, naduke.Options{DryRun: true, Jobs: 4}, files, nil, nil)
+	if err != nil {
+		t.Fatalf("buildPlan: %v", err)
+	}
+	if len(plan) != len(files) {
+		t.Fatalf("expected %d entries, got %d", len(files), len(plan))
+	}
+	for i, entry := range plan {
+		if entry.Source != files[i] {
+			t.Fatalf("entry %d is %s; want %s", i, entry.Source, files[i])
+		}
+	}
+}
+
+func TestBuildPlanPrintsInOrder(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	client := &slowSuggester{delays: map[string]time.Duration{}}
+	var files []string
+	var want strings.Builder
+	for i, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt", "f.txt"} {
+		path := writeFile(t, dir, name, []byte(name))
+		files = append(files, path)
+		// Later files finish first, so every line but the last arrives early.
+		client.delays[name] = time.Duration(6-i) * 5 * time.Millisecond
+		want.WriteString(path + " -> " + filepath.Join(dir, "named_"+name) + "\n")
+	}
+
+	opts := naduke.Options{DryRun: true, Jobs: 6}
+	var out bytes.Buffer
+	_, err := buildPlan(context.Background(), client, opts, files, func(entry planEntry) error {
+		printEntry(&out, opts, entry)
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatalf("buildPlan: %v", err)
+	}
+	if out.String() != want.String() {
+		t.Fatalf("output out of order:\n%s\nwant:\n%s", out.String(), want.String())
+	}
+}
+
+// cancelingSuggester cancels the batch while naming its first file, as a
+// Ctrl-C during a model call would.
+type cancelingSuggester struct {
+	cancel context.CancelFunc
+	calls  int
+}
+
+func (s *cancelingSuggester) SuggestName(opts naduke.Options, path, content string) (string, error) {
+	s.calls++
+	s.cancel()
+	return "named_" + strings.TrimSuffix(filepath.Base(path), ".txt"), nil
+}
+
+func TestBuildPlanStopsOnCancel(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		files = append(files, writeFile(t, dir, name, []byte(name)))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &cancelingSuggester{cancel: cancel}
+	plan, err := buildPlan(ctx, client, naduke.Options{DryRun: true, Jobs: 1}, files, nil, nil)
+	if err != nil {
+		t.Fatalf("buildPlan: %v", err)
+	}
+	if client.calls != 1 || len(plan) != 1 || plan[0].Name != "named_a" {
+		t.Fatalf("expected only the in-progress file to finish, got %d call(s) and %+v", client.calls, plan)
+	}
+}
+
+func TestRunRecursiveSortedOutput(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	b := writeFile(t, root, "b.txt", []byte("beta"))
+	a := writeFile(t, root, "a.txt", []byte("alpha"))
+	c := writeFile(t, filepath.Join(root, "sub"), "c.txt", []byte("gamma"))
+	server := fakeOllama(t, http.StatusOK, "suggested")
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-server", server.URL, "-dry-run", "-recursive", "-jobs", "3", root}, &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	want := []string{a, b, c}
+	if len(lines) != len(want) {
+		t.Fatalf("unexpected output: %q", stdout.String())
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, want[i]+" -> ") {
+			t.Fatalf("line %d = %q; want source %s", i, line, want[i])
+		}
+	}
+}
+
+func TestRunJSONOutput(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"c.txt", "a.txt", "b.txt"} {
+		files = append(files, writeFile(t, dir, name, []byte("notes "+name)))
+	}
+	server := fakeOllama(t, http.StatusOK, "Meeting Notes")
+
+	var stdout, stderr bytes.Buffer
+	args := append([]string{"-server", server.URL, "-dry-run", "-jobs", "3", "-json-stream"}, files...)
+	if code := run(args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	if len(lines) != len(files) {
+		t.Fatalf("expected one line per file, got %q", stdout.String())
+	}
+	for i, line := range lines {
+		var entry jsonEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("line %d is not a JSON object: %v (%q)", i, err, line)
+		}
+		want := filepath.Join(dir, string(rune('a'+i))+".txt")
+		if entry.SchemaVersion != jsonSchemaVersion || entry.Version == "" {
+			t.Fatalf("line %d lacks schema or tool version: %q", i, line)
+		}
+		if entry.Source != want || entry.Name != "meeting_notes" || entry.Raw != "Meeting Notes" || !entry.DryRun {
+			t.Fatalf("unexpected entry %d: %+v", i, entry)
+		}
+	}
+
+	stdout.Reset()
+	args[5] = "-json"
+	if code := run(args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("run exit %d: %s", code, stderr.String())
+	}
+	var entries []jsonEntry
+	if err := json.Unmarshal(stdout.Bytes(), &entries); err != nil {
+		t.Fatalf("-json output is not a JSON array: %v (%q)", err, stdout.String())
+	}
+	if len(entries) != len(files) || entries[0].Source != filepath.Join(dir, "a.txt") {
+		t.Fatalf("unexpected -json entries: %+v", entries)
+	}
+	if strings.Count(stdout.String(), "\n") != 1 {
+		t.Fatalf("-json should be compact by default: %q", stdout.String())
+	}
+
+	for _, mode := range []string{"-json-pretty", "-json-stream"} {
+		stdout.Reset()
+		args := append([]string{"-server", server.URL, "-dry-run", "-json-pretty", mode}, files...)
+		if code := run(args, &stdout, &stderr); code != exitOK {
+			t.Fatalf("run exit %d: %s", code, stderr.String())
+		}
+		dec := json.NewDecoder(&stdout)
+		var values int
+		for dec.More() {
+			var value any
+			if err := dec.Decode(&value); err != nil {
+				t.Fatalf("%s output is not valid JSON: %v", mode, err)
+			}
+			values++
+		}
+		if want := map[string]int{"-json-pretty": 1, "-json-stream": len(files)}[mode]; values != want {
+			t.Fatalf("%s: expected %d JSON values, got %d", mode, want, values)
+		}
+	}
+	stdout.Reset()
+	run(append([]string{"-server", server.URL, "-dry-run", "-json-pretty"}, files...), &stdout, &stderr)
+	if !strings.Contains(stdout.String(), "\n  {\n    \"schema_version\": 1,") {
+		t.Fatalf("-json-pretty should indent: %q", stdout.String())
+	}
+
+	if _, _, _, _, err := parseArgs([]string{"-json", "-json-stream", "a.txt"}); err == nil {
+		t.Fatalf("expected error combining -json and -json-stream")
+	}
+	for _, mode := range []string{"-json", "-json-stream", "-json-pretty"} {
+		if _, _, _, _, err := parseArgs([]string{"-dry-run", "-apply-on-confirm", mode, "a.txt"}); err == nil {
+			t.Fatalf("expected error combining -apply-on-confirm and %s", mode)
+		}
+	}
+}
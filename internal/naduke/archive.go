@@ -0,0 +1,226 @@
+package naduke
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Bounds for reading archives, so huge or deeply packed ones cost no more
+// than a regular sample.
+const (
+	maxArchiveEntries = 1000
+	listedEntries     = 50
+	// maxArchiveScan caps the decompressed bytes walked in a tar stream.
+	maxArchiveScan = 64 << 20
+)
+
+// IsArchive reports whether path has an archive extension ArchiveSample can
+// read: .zip, .tar, .tar.gz or .tgz.
+func IsArchive(path string) bool {
+	switch Ext(path) {
+	case ".zip", ".tar", ".tar.gz", ".tgz":
+		return true
+	}
+	return false
+}
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Ext returns the extension of path like filepath.Ext, but keeps compressed
+// tar extensions such as ".tar.gz" whole so renames do not drop ".tar", and
+// likewise the extension in front of ".gz", as in ".log.gz".
+func Ext(path string) string {
+	lower := strings.ToLower(path)
+	for _, double := range []string{".tar.gz", ".tar.bz2", ".tar.xz", ".tar.zst"} {
+		if strings.HasSuffix(lower, double) && len(path) > len(double) {
+			return path[len(path)-len(double):]
+		}
+	}
+	if strings.HasSuffix(lower, ".gz") {
+		stem := path[:len(path)-len(".gz")]
+		if inner := filepath.Ext(stem); len(inner) > 1 && len(stem) > len(inner) && isLetters(inner[1:]) {
+			return path[len(stem)-len(inner):]
+		}
+	}
+	return filepath.Ext(path)
+}
+
+// isLetters reports whether s consists of ASCII letters only, so version
+// numbers such as the ".2" in "backup.2.gz" are not taken for extensions.
+func isLetters(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// sampleReader returns the reader ReadSample takes its window from: f
+// itself, or the decompressed stream when f is gzip-compressed, detected by
+// its magic bytes or a .gz extension. Archives such as .tar.gz are left to
+// ArchiveSample. Only as much is inflated as the caller reads.
+func sampleReader(path string, f *os.File) (io.Reader, func() error, error) {
+	noop := func() error { return nil }
+	if IsArchive(path) {
+		return f, noop, nil
+	}
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(len(gzipMagic))
+	if !bytes.Equal(magic, gzipMagic) && !strings.EqualFold(filepath.Ext(path), ".gz") {
+		return br, noop, nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, noop, fmt.Errorf("open gzip: %w", err)
+	}
+	return gz, gz.Close, nil
+}
+
+// archiveEntry is a regular file listed in an archive. The reader returned
+// by open must be closed.
+type archiveEntry struct {
+	name string
+	open func() (io.ReadCloser, error)
+}
+
+// ArchiveSample builds a sample for the archive at path without unpacking it
+// to disk: a listing of its first entry names followed by the start of a
+// README, preferring the one closest to the top. Nested archives are only
+// listed, never opened.
+func ArchiveSample(path string) (string, error) {
+	var sample string
+	err := walkArchive(path, func(entries []archiveEntry) error {
+		var b strings.Builder
+		fmt.Fprintf(&b, "Archive %s with %d file(s):\n", filepath.Base(path), len(entries))
+		for i, entry := range entries {
+			if i == listedEntries {
+				fmt.Fprintf(&b, "- ... %d more\n", len(entries)-listedEntries)
+				break
+			}
+			fmt.Fprintf(&b, "- %s\n", entry.name)
+		}
+
+		if readme, ok := pickReadme(entries); ok {
+			r, err := readme.open()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			text, err := io.ReadAll(io.LimitReader(r, readChars*4))
+			if err != nil {
+				return fmt.Errorf("read %s in archive: %w", readme.name, err)
+			}
+			fmt.Fprintf(&b, "\n%s:\n%s", readme.name, text)
+		}
+		// Names and README bytes come from the archive as is.
+		sample = strings.ReplaceAll(strings.ToValidUTF8(b.String(), "\uFFFD"), "\x00", "")
+		return nil
+	})
+	return sample, err
+}
+
+// pickReadme returns the README entry with the fewest path components.
+func pickReadme(entries []archiveEntry) (archiveEntry, bool) {
+	var best archiveEntry
+	bestDepth := -1
+	for _, entry := range entries {
+		base := strings.ToLower(path.Base(entry.name))
+		if !strings.HasPrefix(base, "readme") {
+			continue
+		}
+		depth := strings.Count(strings.Trim(entry.name, "/"), "/")
+		if bestDepth < 0 || depth < bestDepth {
+			best, bestDepth = entry, depth
+		}
+	}
+	return best, bestDepth >= 0
+}
+
+// walkArchive lists the regular files of the archive at archivePath, up to
+// maxArchiveEntries, and hands them to visit while the archive is open.
+func walkArchive(archivePath string, visit func([]archiveEntry) error) error {
+	if Ext(archivePath) == ".zip" {
+		zr, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return fmt.Errorf("open archive: %w", err)
+		}
+		defer zr.Close()
+		var entries []archiveEntry
+		for _, f := range zr.File {
+			if len(entries) == maxArchiveEntries {
+				break
+			}
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			entries = append(entries, archiveEntry{name: f.Name, open: func() (io.ReadCloser, error) {
+				rc, err := f.Open()
+				if err != nil {
+					return nil, fmt.Errorf("open %s in archive: %w", f.Name, err)
+				}
+				return rc, nil
+			}})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+		return visit(entries)
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("open archive: %w", err)
+	}
+	defer f.Close()
+	var stream io.Reader = f
+	if ext := strings.ToLower(Ext(archivePath)); ext == ".tar.gz" || ext == ".tgz" {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("open archive: %w", err)
+		}
+		defer gz.Close()
+		stream = gz
+	}
+
+	// A tar stream can only be read forward, so keep the README text while
+	// passing it; the listing is complete only at the end.
+	tr := tar.NewReader(io.LimitReader(stream, maxArchiveScan))
+	var entries []archiveEntry
+	readmes := make(map[string][]byte)
+	for len(entries) < maxArchiveEntries {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) && len(entries) > 0 {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(hdr.Name, "./")
+		if strings.HasPrefix(strings.ToLower(path.Base(name)), "readme") {
+			text, err := io.ReadAll(io.LimitReader(tr, readChars*4))
+			if err != nil {
+				return fmt.Errorf("read %s in archive: %w", name, err)
+			}
+			readmes[name] = text
+		}
+		entries = append(entries, archiveEntry{name: name, open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(readmes[name])), nil
+		}})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return visit(entries)
+}
@@ -0,0 +1,159 @@
+package naduke
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var archiveFiles = []struct {
+	name, body string
+}{
+	{"project/src/main.go", "package main"},
+	{"project/README.md", "# Invoice tool\nGenerates monthly invoices."},
+	{"project/docs/README.txt", "nested readme"},
+}
+
+func writeZip(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, file := range archiveFiles {
+		w, err := zw.Create(file.name)
+		if err != nil {
+			t.Fatalf("zip create: %v", err)
+		}
+		w.Write([]byte(file.body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip close: %v", err)
+	}
+}
+
+func writeTarGz(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, file := range archiveFiles {
+		if err := tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0o644, Size: int64(len(file.body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("tar header: %v", err)
+		}
+		tw.Write([]byte(file.body))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar close: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+}
+
+func TestArchiveSample(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "bundle.zip")
+	tarPath := filepath.Join(dir, "bundle.tar.gz")
+	writeZip(t, zipPath)
+	writeTarGz(t, tarPath)
+
+	for _, path := range []string{zipPath, tarPath} {
+		sample, err := ReadSample(path, Options{ReadArchives: true})
+		if err != nil {
+			t.Fatalf("ReadSample(%s) error: %v", path, err)
+		}
+		for _, want := range []string{"with 3 file(s)", "- project/src/main.go", "project/README.md:\n# Invoice tool"} {
+			if !strings.Contains(sample, want) {
+				t.Fatalf("%s sample missing %q: %q", filepath.Base(path), want, sample)
+			}
+		}
+		if strings.Contains(sample, "nested readme") {
+			t.Fatalf("the top-level README should win: %q", sample)
+		}
+		if _, err := EnsureTextSample(sample, path); err != nil {
+			t.Fatalf("archive sample should be text: %v", err)
+		}
+	}
+
+	if _, err := ReadSample(zipPath, Options{}); err != nil {
+		t.Fatalf("ReadSample without -read-archives: %v", err)
+	}
+}
+
+func TestExt(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"a.tar.gz":      ".tar.gz",
+		"A.TAR.XZ":      ".TAR.XZ",
+		"notes.txt":     ".txt",
+		".tar.gz":       ".gz",
+		"app.log.gz":    ".log.gz",
+		"backup.2.gz":   ".gz",
+		"dump.gz":       ".gz",
+		"dir.v2/readme": "",
+	}
+	for path, want := range tests {
+		if got := Ext(path); got != want {
+			t.Fatalf("Ext(%q) = %q; want %q", path, got, want)
+		}
+	}
+	if got := destinationPath(t, "/data/bundle.tar.gz", "invoice_tool", Options{}); got != "/data/invoice_tool.tar.gz" {
+		t.Fatalf("compressed tar extension should be kept whole, got %q", got)
+	}
+}
+
+func TestReadSampleGzip(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	text := "2024-05-01 12:00:00 INFO payment service started\n" + strings.Repeat("2024-05-01 12:00:01 INFO request handled\n", 1000)
+	for _, name := range []string{"application.log.gz", "export"} {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		gz := gzip.NewWriter(f)
+		if _, err := gz.Write([]byte(text)); err != nil {
+			t.Fatalf("write gzip: %v", err)
+		}
+		if err := gz.Close(); err != nil {
+			t.Fatalf("close gzip: %v", err)
+		}
+		f.Close()
+
+		sample, err := ReadSample(path, Options{})
+		if err != nil {
+			t.Fatalf("%s: ReadSample error: %v", name, err)
+		}
+		if sample != text[:sampleChars] {
+			t.Fatalf("%s: sample should be the decompressed text, got %q", name, sample)
+		}
+	}
+
+	if got := destinationPath(t, "/logs/application.log.gz", "payment_service_log", Options{}); got != "/logs/payment_service_log.log.gz" {
+		t.Fatalf("gzip extension should be kept, got %q", got)
+	}
+
+	plain := filepath.Join(dir, "notes.gz")
+	if err := os.WriteFile(plain, []byte("not compressed"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if _, err := ReadSample(plain, Options{}); err == nil {
+		t.Fatalf("expected an error for a .gz file that is not gzip")
+	}
+}
@@ -0,0 +1,65 @@
+package naduke
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+const (
+	backoffBase = time.Second
+	backoffCap  = 30 * time.Second
+)
+
+// backoff computes retry waits with decorrelated jitter: each wait is drawn
+// uniformly between backoffBase and three times the previous one, capped at
+// backoffCap. A client shares one backoff between all its workers, so every
+// retry moves the common state and workers that failed at the same instant
+// wake up at different ones instead of hitting the server together again.
+type backoff struct {
+	mu   sync.Mutex
+	prev time.Duration
+	// random returns values in [0, 1); nil means math/rand/v2.
+	random func() float64
+}
+
+// ClientOption adjusts a client built by NewClient.
+type ClientOption func(*client)
+
+// WithBackoffSeed makes the retry jitter of the client a deterministic
+// sequence drawn from seed, so tests can assert exact waits. Without it the
+// jitter is randomly seeded.
+func WithBackoffSeed(seed uint64) ClientOption {
+	return func(c *client) {
+		c.backoff.random = rand.New(rand.NewPCG(seed, seed)).Float64
+	}
+}
+
+// next returns the wait before the next retry.
+func (b *backoff) next() time.Duration {
+	if b == nil {
+		return backoffBase
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	random := rand.Float64
+	if b.random != nil {
+		random = b.random
+	}
+	upper := max(3*b.prev, backoffBase)
+	wait := backoffBase + time.Duration(random()*float64(upper-backoffBase))
+	b.prev = min(wait, backoffCap)
+	return b.prev
+}
+
+// reset starts the next retry from backoffBase again, once a request got
+// through.
+func (b *backoff) reset() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.prev = 0
+	b.mu.Unlock()
+}
@@ -0,0 +1,205 @@
+package naduke
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sequence returns a deterministic jitter source cycling through values.
+func sequence(values ...float64) func() float64 {
+	var mu sync.Mutex
+	i := 0
+	return func() float64 {
+		mu.Lock()
+		defer mu.Unlock()
+		v := values[i%len(values)]
+		i++
+		return v
+	}
+}
+
+func TestBackoffNext(t *testing.T) {
+	t.Parallel()
+
+	b := &backoff{random: sequence(0.5, 1)}
+	want := []time.Duration{
+		backoffBase,      // the first wait has no previous one to grow from
+		3 * time.Second,  // 1s + 1.0 * (3s - 1s)
+		5 * time.Second,  // 1s + 0.5 * (9s - 1s)
+		15 * time.Second, // 1s + 1.0 * (15s - 1s)
+		23 * time.Second, // 1s + 0.5 * (45s - 1s)
+		backoffCap,       // 69s, capped
+	}
+	for i, w := range want {
+		if got := b.next(); got != w {
+			t.Fatalf("wait %d = %v; want %v", i, got, w)
+		}
+	}
+
+	b.reset()
+	if got := b.next(); got != backoffBase {
+		t.Fatalf("wait after reset = %v; want %v", got, backoffBase)
+	}
+
+	var none *backoff
+	if got := none.next(); got != backoffBase {
+		t.Fatalf("nil backoff wait = %v; want %v", got, backoffBase)
+	}
+}
+
+func TestWithBackoffSeed(t *testing.T) {
+	t.Parallel()
+
+	waits := func(options ...ClientOption) []time.Duration {
+		c, err := NewClient(Options{Host: "localhost", Port: 11434}, options...)
+		if err != nil {
+			t.Fatalf("NewClient error: %v", err)
+		}
+		var got []time.Duration
+		for range 5 {
+			got = append(got, c.backoff.next())
+		}
+		return got
+	}
+
+	first, second := waits(WithBackoffSeed(42)), waits(WithBackoffSeed(42))
+	if !slices.Equal(first, second) {
+		t.Fatalf("the same seed gave different waits: %v and %v", first, second)
+	}
+	for i, wait := range first {
+		if wait < backoffBase || wait > backoffCap {
+			t.Fatalf("wait %d = %s; want between %s and %s", i, wait, backoffBase, backoffCap)
+		}
+	}
+	if other := waits(WithBackoffSeed(7)); slices.Equal(first, other) {
+		t.Fatalf("different seeds gave the same waits: %v", first)
+	}
+}
+
+func TestPostSpreadsConcurrentRetries(t *testing.T) {
+	t.Parallel()
+
+	const workers = 5
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	fakeTransport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		first := !seen[string(body)]
+		seen[string(body)] = true
+		mu.Unlock()
+		if first {
+			// Every worker finds the server down on its first attempt.
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: io.NopCloser(strings.NewReader("loading")), Header: make(http.Header)}, nil
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"message":{"role":"assistant","content":"name"}}`)),
+			Header:     make(http.Header),
+		}, nil
+	})
+
+	var waits []time.Duration
+	client := &client{
+		http:    &http.Client{Transport: fakeTransport},
+		uri:     &url.URL{Scheme: "http", Host: "example.com", Path: "/api/chat"},
+		backoff: &backoff{random: sequence(1.0/6, 2.0/6, 3.0/6, 4.0/6, 5.0/6)},
+	}
+
+	// Hold every worker until all have failed once, so no success resets the
+	// shared backoff in between.
+	var failed sync.WaitGroup
+	failed.Add(workers)
+	client.sleep = func(d time.Duration) {
+		mu.Lock()
+		waits = append(waits, d)
+		mu.Unlock()
+		failed.Done()
+		failed.Wait()
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.GenerateName(Options{Model: "test-model", HTTPRetries: 1}, "note.txt", fmt.Sprint("content ", i))
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("GenerateName error: %v", err)
+		}
+	}
+
+	if len(waits) != workers {
+		t.Fatalf("expected one wait per worker, got %v", waits)
+	}
+	distinct := map[time.Duration]bool{}
+	for _, w := range waits {
+		if w < backoffBase || w > backoffCap {
+			t.Fatalf("wait %v outside [%v, %v]", w, backoffBase, backoffCap)
+		}
+		distinct[w] = true
+	}
+	if len(distinct) != workers {
+		t.Fatalf("retries should not fire at the same instant, got waits %v", waits)
+	}
+}
+
+func TestRetryTimeoutStopsRetries(t *testing.T) {
+	t.Parallel()
+
+	requests := 0
+	fakeTransport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: io.NopCloser(strings.NewReader("loading")), Header: make(http.Header)}, nil
+	})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	client := &client{
+		http:    &http.Client{Transport: fakeTransport},
+		uri:     &url.URL{Scheme: "http", Host: "example.com", Path: "/api/chat"},
+		backoff: &backoff{random: sequence(0.5)},
+		sleep:   func(d time.Duration) { now = now.Add(d) },
+		now:     func() time.Time { return now },
+	}
+
+	const budget = 20 * time.Second
+	opts := Options{Model: "test-model", HTTPRetries: 100, Retries: 5, RetryTimeout: budget}
+	_, err := client.SuggestName(opts, "note.txt", "hello")
+	if !errors.Is(err, ErrModelRequestFailed) {
+		t.Fatalf("expected the last 503 as the error, got %v", err)
+	}
+	if elapsed := now.Sub(start); elapsed > budget {
+		t.Fatalf("retried for %v; want at most %v", elapsed, budget)
+	}
+	if requests < 2 || requests > 100 {
+		t.Fatalf("expected a few retries before the budget ran out, got %d requests", requests)
+	}
+
+	// Without a budget the same client retries until -http-retries runs out.
+	requests = 0
+	client.backoff.reset()
+	if _, err := client.SuggestName(Options{Model: "test-model", HTTPRetries: 10}, "note.txt", "hello"); !errors.Is(err, ErrModelRequestFailed) {
+		t.Fatalf("expected a 503 error, got %v", err)
+	}
+	if requests != 11 {
+		t.Fatalf("expected 11 requests without a budget, got %d", requests)
+	}
+}
@@ -0,0 +1,35 @@
+package naduke
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IsBadName reports whether the current name of path, without its extension,
+// matches pattern, i.e. says nothing about the file, as "untitled", "scan001"
+// or a UUID do.
+func IsBadName(path string, pattern *regexp.Regexp) bool {
+	base := filepath.Base(path)
+	return pattern.MatchString(strings.TrimSuffix(base, Ext(base)))
+}
+
+// FilterBadNames keeps the files whose name matches opts.BadNames, so only
+// non-descriptive names are sent to the model; the others are left alone. A
+// nil pattern keeps every file.
+func FilterBadNames(files []string, opts Options) ([]string, []SkippedFile) {
+	if opts.BadNames == nil {
+		return files, nil
+	}
+	kept := make([]string, 0, len(files))
+	var skipped []SkippedFile
+	for _, path := range files {
+		if !IsBadName(path, opts.BadNames) {
+			skipped = append(skipped, SkippedFile{path, fmt.Sprintf("name does not match -bad-name-pattern %s", opts.BadNames)})
+			continue
+		}
+		kept = append(kept, path)
+	}
+	return kept, skipped
+}
@@ -0,0 +1,55 @@
+package naduke
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestIsBadName(t *testing.T) {
+	t.Parallel()
+
+	pattern := regexp.MustCompile(DefaultBadNames)
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"untitled.txt", true},
+		{"Untitled 2.txt", true},
+		{"New Document (3).md", true},
+		{"new_text_document.txt", true},
+		{"scan001.txt", true},
+		{"IMG_1234.txt", true},
+		{"20240501.log", true},
+		{"dir/3f2504e0-4f89-11d3-9a0c-0305e82c3301.json", true},
+		{"meeting_notes.txt", false},
+		{"document_draft.md", false},
+		{"quarterly-report.csv", false},
+		{"scanner_config.yaml", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := IsBadName(tt.path, pattern); got != tt.want {
+				t.Fatalf("IsBadName(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterBadNames(t *testing.T) {
+	t.Parallel()
+
+	files := []string{"untitled.txt", "budget_2024.csv", "scan001.txt"}
+	kept, skipped := FilterBadNames(files, Options{})
+	if !slices.Equal(kept, files) || skipped != nil {
+		t.Fatalf("nil pattern filtered files: kept %v, skipped %v", kept, skipped)
+	}
+
+	kept, skipped = FilterBadNames(files, Options{BadNames: regexp.MustCompile(DefaultBadNames)})
+	if want := []string{"untitled.txt", "scan001.txt"}; !slices.Equal(kept, want) {
+		t.Fatalf("kept = %v, want %v", kept, want)
+	}
+	if len(skipped) != 1 || skipped[0].Path != "budget_2024.csv" {
+		t.Fatalf("skipped = %v, want budget_2024.csv", skipped)
+	}
+}
@@ -0,0 +1,130 @@
+package naduke
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultBatchTokens bounds the estimated size of one -batch request.
+const DefaultBatchTokens = 2000
+
+var (
+	batchSystemPrompt = strings.TrimSpace(`
+You are a tool that generates file names for several files at once.
+You MUST follow these rules for every name:
+- Do not add an extension.
+- Use only lowercase letters a-z, digits 0-9, and underscores.
+- No spaces, no hyphens, no other characters.
+- Less than or equal than 30 characters.
+- Make each name concise but descriptive of that file's content.
+Reply with only a JSON array of strings, one name per file in the order the
+files are given, and nothing else.
+`)
+	batchUserPrompt = "Generate an appropriate file name for each of these %d text files.\n"
+)
+
+// BatchFile is one file of a -batch request: its path and prepared sample.
+type BatchFile struct {
+	Path    string
+	Content string
+}
+
+// EstimateTokens approximates the tokens text takes, at four characters per
+// token.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// PlanBatches groups files, in order, into batches of at most opts.Batch
+// files whose samples together stay within opts.BatchTokens (or
+// DefaultBatchTokens). Only files sent to the same model share a batch. Files
+// too large for any batch, and batches that would hold a single file, are
+// left out so they are named one by one.
+func PlanBatches(files []BatchFile, opts Options) [][]BatchFile {
+	budget := opts.BatchTokens
+	if budget <= 0 {
+		budget = DefaultBatchTokens
+	}
+	type open struct {
+		files  []BatchFile
+		tokens int
+	}
+	var batches [][]BatchFile
+	pending := map[string]*open{}
+	var models []string
+	flush := func(model string) {
+		if b := pending[model]; b != nil && len(b.files) > 1 {
+			batches = append(batches, b.files)
+		}
+		delete(pending, model)
+	}
+	for _, file := range files {
+		tokens := EstimateTokens(file.Content)
+		if tokens > budget {
+			continue
+		}
+		model := ModelFor(opts, file.Path)
+		b := pending[model]
+		if b != nil && (len(b.files) == opts.Batch || b.tokens+tokens > budget) {
+			flush(model)
+			b = nil
+		}
+		if b == nil {
+			b = &open{}
+			pending[model] = b
+			models = append(models, model)
+		}
+		b.files = append(b.files, file)
+		b.tokens += tokens
+	}
+	for _, model := range models {
+		flush(model)
+	}
+	return batches
+}
+
+// SuggestNames asks the model for the names of all files in a single request
+// and returns them in order. The raw answers are not validated. An answer
+// that is not a JSON array with one name per file is an error wrapping
+// ErrBatchMismatch, so the caller can fall back to naming the files one by one.
+func (c *client) SuggestNames(opts Options, files []BatchFile) ([]string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, batchUserPrompt, len(files))
+	for i, file := range files {
+		fmt.Fprintf(&b, "\n<file number=\"%d\">\n%s\n</file>\n", i+1, NeutralizeDelimiters(file.Content, "file"))
+	}
+	messages := []chatMessage{
+		{Role: "system", Content: batchSystemPrompt},
+		{Role: "user", Content: b.String()},
+	}
+	slog.Debug("batch request", "files", len(files), "first", files[0].Path)
+	var size int64
+	for _, file := range files {
+		size += fileSize(file.Path)
+	}
+	answer, err := c.withRetryBudget(opts).withRequestTimeout(opts, size).complete(opts, files[0].Path, ModelsFor(opts, files[0].Path), messages)
+	if err != nil {
+		return nil, err
+	}
+	return parseBatchAnswer(answer, len(files))
+}
+
+// parseBatchAnswer extracts the JSON array of want names from answer,
+// tolerating surrounding prose or a code fence.
+func parseBatchAnswer(answer string, want int) ([]string, error) {
+	start, end := strings.IndexByte(answer, '['), strings.LastIndexByte(answer, ']')
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("%w: no JSON array in %q", ErrBatchMismatch, answer)
+	}
+	var names []string
+	if err := json.Unmarshal([]byte(answer[start:end+1]), &names); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBatchMismatch, err)
+	}
+	if len(names) != want {
+		return nil, fmt.Errorf("%w: got %d names for %d files", ErrBatchMismatch, len(names), want)
+	}
+	return names, nil
+}
@@ -0,0 +1,67 @@
+package naduke
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// Model capabilities as reported by Ollama's /api/show, for
+// -require-capability.
+const (
+	CapabilityCompletion = "completion"
+	CapabilityVision     = "vision"
+	CapabilityTools      = "tools"
+	CapabilityEmbedding  = "embedding"
+	CapabilityThinking   = "thinking"
+)
+
+// ModelCapabilities returns the capabilities the server reports for model.
+// Servers too old to report any return an empty list.
+func (c *client) ModelCapabilities(model string) ([]string, error) {
+	show, err := c.show(model)
+	if err != nil {
+		return nil, err
+	}
+	return show.Capabilities, nil
+}
+
+// RequireCapabilities checks that every model the run may use, opts.Model,
+// opts.FallbackModels and those from opts.ModelForExt, has each of
+// opts.RequiredCapabilities, so a feature that needs one fails before any
+// file is read instead of on every file. A server that reports no
+// capabilities cannot be checked; that is logged and let through.
+func (c *client) RequireCapabilities(opts Options) error {
+	if len(opts.RequiredCapabilities) == 0 {
+		return nil
+	}
+	for _, model := range runModels(opts) {
+		capabilities, err := c.ModelCapabilities(model)
+		if err != nil {
+			return err
+		}
+		if len(capabilities) == 0 {
+			slog.Warn("server does not report model capabilities; skipping the check", "model", model)
+			continue
+		}
+		for _, required := range opts.RequiredCapabilities {
+			if !slices.Contains(capabilities, required) {
+				return fmt.Errorf("%w: %s does not support %s (it supports: %s)", ErrMissingCapability, model, required, strings.Join(capabilities, ", "))
+			}
+		}
+		slog.Debug("model capabilities", "model", model, "capabilities", capabilities)
+	}
+	return nil
+}
+
+// runModels returns every model opts may send a request to, sorted and
+// without repeats.
+func runModels(opts Options) []string {
+	models := append([]string{opts.Model}, opts.FallbackModels...)
+	for _, model := range opts.ModelForExt {
+		models = append(models, model)
+	}
+	slices.Sort(models)
+	return slices.Compact(models)
+}
@@ -0,0 +1,66 @@
+package naduke
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRequireCapabilities(t *testing.T) {
+	t.Parallel()
+
+	capabilities := map[string]string{
+		"text":   `{"capabilities":["completion","tools"]}`,
+		"vision": `{"capabilities":["completion","vision"]}`,
+		"old":    `{"parameters":"num_ctx 4096"}`,
+	}
+	var asked []string
+	fakeTransport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/api/show" {
+			t.Fatalf("unexpected path: %s", req.URL.Path)
+		}
+		var payload struct {
+			Model string `json:"model"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		asked = append(asked, payload.Model)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(capabilities[payload.Model])),
+			Header:     make(http.Header),
+		}, nil
+	})
+	client := &client{
+		http: &http.Client{Transport: fakeTransport},
+		uri:  &url.URL{Scheme: "http", Host: "example.com", Path: "/api/chat"},
+	}
+
+	opts := Options{Model: "text", RequiredCapabilities: []string{CapabilityVision}}
+	err := client.RequireCapabilities(opts)
+	if !errors.Is(err, ErrMissingCapability) || !IsModelError(err) {
+		t.Fatalf("expected ErrMissingCapability, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "text does not support vision (it supports: completion, tools)") {
+		t.Fatalf("unclear error: %v", err)
+	}
+
+	asked = nil
+	opts = Options{Model: "vision", FallbackModels: []string{"old"}, ModelForExt: map[string]string{".png": "vision"}, RequiredCapabilities: []string{CapabilityVision}}
+	if err := client.RequireCapabilities(opts); err != nil {
+		t.Fatalf("RequireCapabilities error: %v", err)
+	}
+	if strings.Join(asked, ",") != "old,vision" {
+		t.Fatalf("asked about %v; want each model once", asked)
+	}
+
+	asked = nil
+	if err := client.RequireCapabilities(Options{Model: "text"}); err != nil || asked != nil {
+		t.Fatalf("no required capability should skip the check: %v, %v", err, asked)
+	}
+}
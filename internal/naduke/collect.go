@@ -0,0 +1,223 @@
+package naduke
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CollectFiles expands the command-line arguments into the files to name.
+// With opts.Recursive, directory arguments are walked and every regular file
+// below them is included. The result is sorted by path with duplicates
+// removed, so output is reproducible regardless of argument order or how
+// concurrent workers finish. Files last modified before opts.Since, or
+// whose extension is not in a non-empty opts.OnlyExts, are left out.
+func CollectFiles(args []string, opts Options) ([]string, error) {
+	seen := make(map[string]bool, len(args))
+	var files []string
+	add := func(path string) {
+		if !seen[path] && keepFile(path, opts) {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, arg := range args {
+		if !opts.Recursive {
+			add(arg)
+			continue
+		}
+		info, err := os.Stat(arg)
+		if err != nil || !info.IsDir() {
+			// Let the per-file step report missing or unreadable paths.
+			add(arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				add(path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("walk %s: %w", arg, err)
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// TreeRoots returns the arguments that are directories, the roots
+// -preserve-tree mirrors below -dir.
+func TreeRoots(args []string) []string {
+	var roots []string
+	for _, arg := range args {
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			roots = append(roots, arg)
+		}
+	}
+	return roots
+}
+
+// keepFile reports whether path passes the collection filters. Paths that
+// cannot be stat'ed are kept so the per-file step reports them.
+func keepFile(path string, opts Options) bool {
+	if opts.Sidecar && IsSidecar(path) {
+		slog.Debug("skip sidecar file", "path", path)
+		return false
+	}
+	if len(opts.OnlyExts) > 0 && !opts.OnlyExts[NormalizeExt(filepath.Ext(path))] && !opts.OnlyExts[NormalizeExt(Ext(path))] {
+		slog.Debug("skip file not matching -ext", "path", path)
+		return false
+	}
+	if opts.Since.IsZero() {
+		return true
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	if info.ModTime().Before(opts.Since) {
+		slog.Debug("skip file modified before -since", "path", path, "modified", info.ModTime())
+		return false
+	}
+	return true
+}
+
+// CheckWritable makes sure every directory files would be renamed into can
+// be written, by creating and removing a temporary file in each unique one.
+// Directories that do not exist are left for the per-file step to report.
+// The error wraps ErrNotWritable and lists every failing directory.
+func CheckWritable(files []string, opts Options) error {
+	seen := make(map[string]bool)
+	var unwritable []string
+	for _, path := range files {
+		dir := DestinationDir(path, opts)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		probe, err := os.CreateTemp(dir, ".naduke-write-check-*")
+		if err != nil {
+			unwritable = append(unwritable, dir)
+			continue
+		}
+		probe.Close()
+		os.Remove(probe.Name())
+	}
+	if len(unwritable) > 0 {
+		return fmt.Errorf("%w: %s", ErrNotWritable, strings.Join(unwritable, ", "))
+	}
+	return nil
+}
+
+// SkippedFile is a collected file left out by a filter, with the reason to
+// report.
+type SkippedFile struct {
+	Path   string
+	Reason string
+}
+
+// FilterSize drops files smaller than opts.MinSize or larger than
+// opts.MaxSize; a zero limit is not checked. Paths that cannot be stat'ed are
+// kept so the per-file step reports them.
+func FilterSize(files []string, opts Options) ([]string, []SkippedFile) {
+	if opts.MinSize == 0 && opts.MaxSize == 0 {
+		return files, nil
+	}
+	kept := make([]string, 0, len(files))
+	var skipped []SkippedFile
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			kept = append(kept, path)
+			continue
+		}
+		switch size := info.Size(); {
+		case opts.MinSize > 0 && size < opts.MinSize:
+			skipped = append(skipped, SkippedFile{path, fmt.Sprintf("%s is below -min-size %s", FormatSize(size), FormatSize(opts.MinSize))})
+		case opts.MaxSize > 0 && size > opts.MaxSize:
+			skipped = append(skipped, SkippedFile{path, fmt.Sprintf("%s is above -max-size %s", FormatSize(size), FormatSize(opts.MaxSize))})
+		default:
+			kept = append(kept, path)
+		}
+	}
+	return kept, skipped
+}
+
+var sizeUnits = []string{"B", "K", "M", "G", "T"}
+
+// ParseSize reads a human file size such as "512", "1k", "10M" or "1.5GB".
+// Units are powers of 1024 and case-insensitive; a trailing "B" or "iB" is
+// optional.
+func ParseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	multiplier := int64(1)
+	for i := len(sizeUnits) - 1; i > 0; i-- {
+		if rest, ok := strings.CutSuffix(s, sizeUnits[i]); ok {
+			s = rest
+			multiplier = 1 << (10 * i)
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q: want a number with an optional unit like 1k or 10M", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// FormatSize renders n bytes with the largest unit that keeps it at or above
+// one, rounded to a tenth, e.g. "512B", "1.5K", "10M".
+func FormatSize(n int64) string {
+	size := float64(n)
+	unit := 0
+	for size >= 1024 && unit < len(sizeUnits)-1 {
+		size /= 1024
+		unit++
+	}
+	return strconv.FormatFloat(math.Round(size*10)/10, 'f', -1, 64) + sizeUnits[unit]
+}
+
+// sinceLayouts are the absolute forms accepted by ParseSince.
+var sinceLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// ParseSince turns a -since value into a cutoff time. It accepts a duration
+// before now, either as a Go duration ("90m", "24h") or in days ("7d"), or an
+// absolute date or time ("2024-05-01", RFC 3339). Dates without a zone are
+// read in now's location.
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.ParseFloat(days, 64); err == nil && n >= 0 {
+			return now.Add(-time.Duration(n * float64(24*time.Hour))), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("invalid -since %q: duration must not be negative", value)
+		}
+		return now.Add(-d), nil
+	}
+	for _, layout := range sinceLayouts {
+		if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid -since %q: want a duration like 24h or 7d, or a date like 2006-01-02", value)
+}
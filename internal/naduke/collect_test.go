@@ -0,0 +1,235 @@
+package naduke
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCollectFiles(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for _, rel := range []string{"b.txt", "a.txt", "sub/d.md", "sub/c.txt", "sub/deeper/e.txt"} {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(rel), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	join := func(rel string) string { return filepath.Join(root, rel) }
+
+	got, err := CollectFiles([]string{root}, Options{Recursive: true})
+	if err != nil {
+		t.Fatalf("CollectFiles error: %v", err)
+	}
+	want := []string{join("a.txt"), join("b.txt"), join("sub/c.txt"), join("sub/d.md"), join("sub/deeper/e.txt")}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("recursive collect = %v; want %v", got, want)
+	}
+
+	// Explicit files come back sorted and de-duplicated, directories untouched.
+	got, err = CollectFiles([]string{join("b.txt"), join("a.txt"), join("b.txt"), join("sub")}, Options{})
+	if err != nil {
+		t.Fatalf("CollectFiles error: %v", err)
+	}
+	want = []string{join("a.txt"), join("b.txt"), join("sub")}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("explicit collect = %v; want %v", got, want)
+	}
+}
+
+func TestCollectFilesSince(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	now := time.Now()
+	old := filepath.Join(root, "old.txt")
+	recent := filepath.Join(root, "recent.txt")
+	for _, path := range []string{old, recent} {
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := os.Chtimes(old, now.Add(-48*time.Hour), now.Add(-48*time.Hour)); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	missing := filepath.Join(root, "missing.txt")
+
+	got, err := CollectFiles([]string{root, missing}, Options{Recursive: true, Since: now.Add(-24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("CollectFiles error: %v", err)
+	}
+	want := []string{missing, recent}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("collect since = %v; want %v", got, want)
+	}
+}
+
+func TestCollectFilesOnlyExts(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.MD", "c.go", "noext", filepath.Join("sub", "d.Txt"), filepath.Join("sub", "e.tar.gz")} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("x"), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	opts := Options{Recursive: true, OnlyExts: map[string]bool{".txt": true, ".md": true, ".tar.gz": true}}
+	got, err := CollectFiles([]string{root, filepath.Join(root, "c.go")}, opts)
+	if err != nil {
+		t.Fatalf("CollectFiles error: %v", err)
+	}
+	want := []string{filepath.Join(root, "a.txt"), filepath.Join(root, "b.MD"), filepath.Join(root, "sub", "d.Txt"), filepath.Join(root, "sub", "e.tar.gz")}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("collect with -ext = %v; want %v", got, want)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"24h", now.Add(-24 * time.Hour)},
+		{"90m", now.Add(-90 * time.Minute)},
+		{"7d", now.Add(-7 * 24 * time.Hour)},
+		{"1.5d", now.Add(-36 * time.Hour)},
+		{"2024-05-01", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{"2024-05-01 08:30:00", time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)},
+		{"2024-05-01T08:30:00+09:00", time.Date(2024, 4, 30, 23, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := ParseSince(tt.value, now)
+		if err != nil {
+			t.Fatalf("ParseSince(%q) error: %v", tt.value, err)
+		}
+		if !got.Equal(tt.want) {
+			t.Fatalf("ParseSince(%q) = %v; want %v", tt.value, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "yesterday", "-1h", "-2d", "2024-13-01"} {
+		if _, err := ParseSince(bad, now); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestFilterSize(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	sizes := map[string]int{"tiny.txt": 3, "ok.txt": 2048, "huge.txt": 5000}
+	var files []string
+	for _, name := range []string{"huge.txt", "ok.txt", "tiny.txt"} {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, make([]byte, sizes[name]), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		files = append(files, path)
+	}
+	missing := filepath.Join(root, "missing.txt")
+	files = append(files, missing)
+
+	kept, skipped := FilterSize(files, Options{MinSize: 1024, MaxSize: 4096})
+	if want := []string{filepath.Join(root, "ok.txt"), missing}; !reflect.DeepEqual(kept, want) {
+		t.Fatalf("kept = %v; want %v", kept, want)
+	}
+	want := []SkippedFile{
+		{filepath.Join(root, "huge.txt"), "4.9K is above -max-size 4K"},
+		{filepath.Join(root, "tiny.txt"), "3B is below -min-size 1K"},
+	}
+	if !reflect.DeepEqual(skipped, want) {
+		t.Fatalf("skipped = %v; want %v", skipped, want)
+	}
+
+	if kept, skipped := FilterSize(files, Options{}); len(kept) != len(files) || skipped != nil {
+		t.Fatalf("no limits should keep every file, got %v and %v", kept, skipped)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"512", 512},
+		{"512b", 512},
+		{"1k", 1024},
+		{"1KB", 1024},
+		{"1KiB", 1024},
+		{"10M", 10 << 20},
+		{"1.5g", 3 << 29},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.value)
+		if err != nil {
+			t.Fatalf("ParseSize(%q) error: %v", tt.value, err)
+		}
+		if got != tt.want {
+			t.Fatalf("ParseSize(%q) = %d; want %d", tt.value, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "k", "ten", "-1k", "1x"} {
+		if _, err := ParseSize(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+
+	for n, want := range map[int64]string{0: "0B", 512: "512B", 1536: "1.5K", 10 << 20: "10M"} {
+		if got := FormatSize(n); got != want {
+			t.Fatalf("FormatSize(%d) = %q; want %q", n, got, want)
+		}
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	t.Parallel()
+
+	if os.Geteuid() == 0 {
+		t.Skip("permission bits do not restrict root")
+	}
+	root := t.TempDir()
+	writable := filepath.Join(root, "rw")
+	readOnly := filepath.Join(root, "ro")
+	for _, dir := range []string{writable, readOnly} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+	if err := os.Chmod(readOnly, 0o555); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+	t.Cleanup(func() { os.Chmod(readOnly, 0o755) })
+
+	files := []string{filepath.Join(writable, "a.txt"), filepath.Join(readOnly, "b.txt"), filepath.Join(readOnly, "c.txt")}
+	err := CheckWritable(files, Options{})
+	if !errors.Is(err, ErrNotWritable) {
+		t.Fatalf("expected ErrNotWritable, got %v", err)
+	}
+	if want := ErrNotWritable.Error() + ": " + readOnly; err.Error() != want {
+		t.Fatalf("error = %q; want %q", err, want)
+	}
+	if err := CheckWritable(files, Options{Dir: writable}); err != nil {
+		t.Fatalf("-dir target is writable: %v", err)
+	}
+	entries, _ := os.ReadDir(writable)
+	if len(entries) != 0 {
+		t.Fatalf("write check left files behind: %v", entries)
+	}
+}
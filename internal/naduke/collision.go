@@ -0,0 +1,183 @@
+package naduke
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Collision strategies for -on-collision.
+const (
+	CollisionError  = "error"
+	CollisionSuffix = "suffix"
+	CollisionHash   = "hash"
+)
+
+// Fallbacks for -on-ambiguous, when the answer sanitizes to the generic
+// "file".
+const (
+	AmbiguousKeep = "keep"
+	AmbiguousHash = "hash"
+	AmbiguousFile = "file"
+)
+
+// Hash sources for -hash-source.
+const (
+	HashSourceSample = "sample"
+	HashSourceFile   = "file"
+)
+
+// ParseCollision validates an -on-collision value.
+func ParseCollision(value string) error {
+	switch value {
+	case CollisionError, CollisionSuffix, CollisionHash:
+		return nil
+	default:
+		return fmt.Errorf("unknown collision strategy %q (want %s, %s or %s)", value, CollisionError, CollisionSuffix, CollisionHash)
+	}
+}
+
+// ParseAmbiguous validates an -on-ambiguous value.
+func ParseAmbiguous(value string) error {
+	switch value {
+	case AmbiguousKeep, AmbiguousHash, AmbiguousFile:
+		return nil
+	default:
+		return fmt.Errorf("unknown ambiguous-name fallback %q (want %s, %s or %s)", value, AmbiguousKeep, AmbiguousHash, AmbiguousFile)
+	}
+}
+
+// IsFallbackName reports whether name, as returned by SanitizeSuggestion, is
+// only the generic "file" that an unusable answer sanitizes to.
+func IsFallbackName(name string, opts Options) bool {
+	if opts.AllowExt {
+		name, _ = SplitExtension(name, opts.AllowedExts)
+	}
+	return name == "file"
+}
+
+// AmbiguousName applies opts.OnAmbiguous to a name IsFallbackName rejected.
+// AmbiguousKeep returns path's current base name and true, meaning it must be
+// used as is; AmbiguousHash returns "file_" with the first opts.HashLength
+// hex digits of the content hash; AmbiguousFile keeps name. Every fallback
+// but AmbiguousFile is logged as a warning.
+func AmbiguousName(path, name, sample string, opts Options) (string, bool, error) {
+	switch opts.OnAmbiguous {
+	case AmbiguousFile:
+		return name, false, nil
+	case AmbiguousHash:
+		sum, err := ContentHash(path, sample, opts)
+		if err != nil {
+			return "", false, err
+		}
+		length := opts.HashLength
+		if length <= 0 {
+			length = DefaultHashLength
+		}
+		hashed := "file_" + sum[:length]
+		if _, ext := SplitExtension(name, opts.AllowedExts); opts.AllowExt && ext != "" {
+			hashed += ext
+		}
+		slog.Warn("model gave no usable name; using a content hash", "path", path, "name", hashed)
+		return hashed, false, nil
+	default:
+		slog.Warn("model gave no usable name; keeping the current name", "path", path)
+		return strings.TrimSuffix(filepath.Base(path), Ext(path)), true, nil
+	}
+}
+
+// ResolveCollision returns the name to use for path when newName's
+// destination is already taken. With CollisionSuffix a counter is appended
+// (name_2, name_3, ...); with CollisionHash the first opts.HashLength hex
+// digits of the content's SHA-256 are, and a hashed name that is still taken
+// fails with ErrDestinationExists. CollisionError keeps newName so the rename
+// itself reports the collision. sample is the text read from path, used when
+// opts.HashSource is HashSourceSample.
+func ResolveCollision(path, newName, sample string, opts Options, taken func(destination string) bool) (string, error) {
+	destination, err := DestinationPath(path, newName, opts)
+	if err != nil {
+		return "", err
+	}
+	if !taken(destination) {
+		return newName, nil
+	}
+
+	switch opts.OnCollision {
+	case CollisionSuffix:
+		for n := 2; ; n++ {
+			candidate := fmt.Sprintf("%s_%d", newName, n)
+			numbered, err := DestinationPath(path, candidate, opts)
+			if err != nil {
+				return "", err
+			}
+			if !taken(numbered) {
+				return candidate, nil
+			}
+		}
+	case CollisionHash:
+		sum, err := ContentHash(path, sample, opts)
+		if err != nil {
+			return "", err
+		}
+		candidate := newName + "_" + sum[:min(opts.HashLength, len(sum))]
+		hashed, err := DestinationPath(path, candidate, opts)
+		if err != nil {
+			return "", err
+		}
+		if taken(hashed) {
+			return "", fmt.Errorf("%w - %s", ErrDestinationExists, hashed)
+		}
+		return candidate, nil
+	default:
+		return newName, nil
+	}
+}
+
+// ContentHash returns the hex hash, by opts.HashAlgorithm, of sample or, with
+// HashSourceFile, of the whole file at path.
+func ContentHash(path, sample string, opts Options) (string, error) {
+	h := newHash(opts)
+	if opts.HashSource == HashSourceSample {
+		io.WriteString(h, sample)
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open file: %w", err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hash file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FindDuplicates hashes the content of files and maps every file whose
+// content matches an earlier one to that first file, its representative.
+// Files that cannot be read are left out for the per-file step to report.
+// Contents are compared by their opts.HashAlgorithm hash.
+func FindDuplicates(files []string, opts Options) map[string]string {
+	firstByHash := make(map[string]string)
+	duplicateOf := make(map[string]string)
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		sum, err := ContentHash(path, "", Options{HashSource: HashSourceFile, HashAlgorithm: opts.HashAlgorithm})
+		if err != nil {
+			continue
+		}
+		if first, ok := firstByHash[sum]; ok {
+			duplicateOf[path] = first
+			continue
+		}
+		firstByHash[sum] = path
+	}
+	return duplicateOf
+}
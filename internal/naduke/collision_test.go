@@ -0,0 +1,151 @@
+package naduke
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveCollision(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "draft.txt")
+	if err := os.WriteFile(src, []byte("quarterly report"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	fileSum := sha256.Sum256([]byte("quarterly report"))
+	sampleSum := sha256.Sum256([]byte("quarterly"))
+
+	taken := map[string]bool{
+		filepath.Join(dir, "report.txt"):   true,
+		filepath.Join(dir, "report_2.txt"): true,
+	}
+	isTaken := func(dest string) bool { return taken[dest] }
+
+	tests := []struct {
+		name string
+		opts Options
+		in   string
+		want string
+	}{
+		{"free", Options{OnCollision: CollisionSuffix}, "summary", "summary"},
+		{"error keeps name", Options{OnCollision: CollisionError}, "report", "report"},
+		{"suffix", Options{OnCollision: CollisionSuffix}, "report", "report_3"},
+		{"hash of file", Options{OnCollision: CollisionHash, HashLength: 6, HashSource: HashSourceFile}, "report", "report_" + hex.EncodeToString(fileSum[:])[:6]},
+		{"hash of sample", Options{OnCollision: CollisionHash, HashLength: 8, HashSource: HashSourceSample}, "report", "report_" + hex.EncodeToString(sampleSum[:])[:8]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveCollision(src, tt.in, "quarterly", tt.opts, isTaken)
+			if err != nil {
+				t.Fatalf("ResolveCollision error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("ResolveCollision = %q; want %q", got, tt.want)
+			}
+		})
+	}
+
+	hashed := Options{OnCollision: CollisionHash, HashLength: 6, HashSource: HashSourceFile}
+	taken[filepath.Join(dir, "report_"+hex.EncodeToString(fileSum[:])[:6]+".txt")] = true
+	if _, err := ResolveCollision(src, "report", "", hashed, isTaken); !errors.Is(err, ErrDestinationExists) {
+		t.Fatalf("expected ErrDestinationExists for a taken hashed name, got %v", err)
+	}
+
+	if err := ParseCollision("overwrite"); err == nil {
+		t.Fatalf("expected error for unknown strategy")
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	contents := map[string]string{"a.txt": "same", "b.txt": "other", "c.txt": "same", "d.txt": "same"}
+	var files []string
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents[name]), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		files = append(files, path)
+	}
+	files = append(files, filepath.Join(dir, "missing.txt"))
+
+	got := FindDuplicates(files, Options{})
+	want := map[string]string{
+		filepath.Join(dir, "c.txt"): filepath.Join(dir, "a.txt"),
+		filepath.Join(dir, "d.txt"): filepath.Join(dir, "a.txt"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("FindDuplicates = %v; want %v", got, want)
+	}
+}
+
+func TestIsFallbackName(t *testing.T) {
+	t.Parallel()
+
+	allowExt := Options{AllowExt: true, AllowedExts: []string{"csv"}}
+	tests := []struct {
+		name string
+		opts Options
+		want bool
+	}{
+		{SanitizeSuggestion("__!__", Options{}), Options{}, true},
+		{"file", Options{}, true},
+		{"file.csv", allowExt, true},
+		{"file.csv", Options{}, false},
+		{"profile", Options{}, false},
+		{"file_2", Options{}, false},
+	}
+	for _, tt := range tests {
+		if got := IsFallbackName(tt.name, tt.opts); got != tt.want {
+			t.Fatalf("IsFallbackName(%q) = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestContentHashAlgorithms(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		algorithm string
+		want      string
+	}{
+		{"", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{HashSHA256, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{HashSHA1, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+		{HashSHA512, "9b71d224bd62f3785d96d46ad3ea3d73319bfbc2890caadae2dff72519673ca72323c3d99ba5c11d7c7acc6e14b8c5da0c4663475c2e5c3adef46f73bcdec043"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			opts := Options{HashSource: HashSourceSample, HashAlgorithm: tt.algorithm}
+			for range 2 {
+				got, err := ContentHash("", "hello", opts)
+				if err != nil {
+					t.Fatalf("ContentHash error: %v", err)
+				}
+				if got != tt.want {
+					t.Fatalf("ContentHash = %s; want %s", got, tt.want)
+				}
+			}
+			if n := HashHexLength(opts); n != len(tt.want) {
+				t.Fatalf("HashHexLength = %d; want %d", n, len(tt.want))
+			}
+			key, _ := suggestionKey(opts, []string{"m"}, []chatMessage{{Role: "user", Content: "hello"}})
+			again, _ := suggestionKey(opts, []string{"m"}, []chatMessage{{Role: "user", Content: "hello"}})
+			if key != again || len(key) != len(tt.want)/2 {
+				t.Fatalf("suggestionKey is not stable: %x, %x", key, again)
+			}
+		})
+	}
+
+	if err := ParseHashAlgorithm("blake3"); err == nil {
+		t.Fatal("expected error for an unknown hash algorithm")
+	}
+}
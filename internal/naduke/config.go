@@ -0,0 +1,211 @@
+package naduke
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configKey matches a bare TOML key, which names a command-line flag.
+var configKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Config holds the settings read from a config file. Keys are flag names and
+// values are flag values; a repeatable flag may have several. Settings apply
+// to every run and a profile's settings override them.
+type Config struct {
+	Settings map[string][]string
+	Profiles map[string]map[string][]string
+}
+
+// DefaultConfigPath returns naduke/config.toml in the user's config
+// directory, or "" when there is none.
+func DefaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "naduke", "config.toml")
+}
+
+// ParseConfig reads a config file written in a subset of TOML: top-level
+// key = value lines, then [profiles.NAME] tables of the same. Values are
+// strings, numbers, booleans or single-line arrays of them.
+func ParseConfig(r io.Reader) (*Config, error) {
+	config := &Config{Settings: map[string][]string{}, Profiles: map[string]map[string][]string{}}
+	table := config.Settings
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(stripConfigComment(scanner.Text()))
+		if text == "" {
+			continue
+		}
+		if header, ok := strings.CutPrefix(text, "["); ok {
+			name, ok := strings.CutSuffix(header, "]")
+			name, isProfile := strings.CutPrefix(strings.TrimSpace(name), "profiles.")
+			if unquoted, err := strconv.Unquote(name); err == nil {
+				name = unquoted
+			}
+			if !ok || !isProfile || name == "" {
+				return nil, fmt.Errorf("config line %d: unexpected table %s (want [profiles.NAME])", line, text)
+			}
+			if _, dup := config.Profiles[name]; dup {
+				return nil, fmt.Errorf("config line %d: profile %q defined twice", line, name)
+			}
+			table = map[string][]string{}
+			config.Profiles[name] = table
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !configKey.MatchString(key) {
+			return nil, fmt.Errorf("config line %d: want key = value, got %q", line, text)
+		}
+		if _, dup := table[key]; dup {
+			return nil, fmt.Errorf("config line %d: %s set twice", line, key)
+		}
+		values, err := parseConfigValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("config line %d: %s: %w", line, key, err)
+		}
+		table[key] = values
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	return config, nil
+}
+
+// Profile returns the settings for the named profile on top of the
+// top-level ones. An empty name selects the top-level settings alone. An
+// unknown profile is an error listing the defined ones.
+func (c *Config) Profile(name string) (map[string][]string, error) {
+	settings := make(map[string][]string, len(c.Settings))
+	for key, values := range c.Settings {
+		settings[key] = values
+	}
+	if name == "" {
+		return settings, nil
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(c.Profiles))
+		for known := range c.Profiles {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("unknown profile %q: the config file defines none", name)
+		}
+		return nil, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	for key, values := range profile {
+		settings[key] = values
+	}
+	return settings, nil
+}
+
+// parseConfigValue turns a TOML value into flag values: one for a scalar, one
+// per element for an array.
+func parseConfigValue(value string) ([]string, error) {
+	inner, isArray := strings.CutPrefix(value, "[")
+	if !isArray {
+		v, err := parseConfigScalar(value)
+		if err != nil {
+			return nil, err
+		}
+		return []string{v}, nil
+	}
+	inner, ok := strings.CutSuffix(inner, "]")
+	if !ok {
+		return nil, fmt.Errorf("unterminated array %s", value)
+	}
+	var values []string
+	for _, item := range splitConfigArray(inner) {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		v, err := parseConfigScalar(item)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func parseConfigScalar(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", value)
+		}
+		return s, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") || strings.Contains(value[1:len(value)-1], "'") {
+			return "", fmt.Errorf("invalid string %s", value)
+		}
+		return value[1 : len(value)-1], nil
+	case value == "true" || value == "false":
+		return value, nil
+	}
+	if _, err := strconv.ParseFloat(strings.ReplaceAll(value, "_", ""), 64); err != nil {
+		return "", fmt.Errorf("invalid value %q (quote strings)", value)
+	}
+	return strings.ReplaceAll(value, "_", ""), nil
+}
+
+// splitConfigArray splits the inside of an array at commas outside quotes.
+func splitConfigArray(inner string) []string {
+	var items []string
+	var quote rune
+	escaped := false
+	start := 0
+	for i, r := range inner {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			items = append(items, inner[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, inner[start:])
+}
+
+// stripConfigComment drops a # comment that is not inside a string.
+func stripConfigComment(line string) string {
+	var quote rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,76 @@
+package naduke
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Parallel()
+
+	config, err := ParseConfig(strings.NewReader(`
+# defaults for every run
+model = "granite4:3b-h" # trailing comment
+temperature = 0.2
+dry-run = true
+prefilter = ["a,b", 'c#d', "say \"hi\""]
+
+[profiles.work]
+host = "ollama.corp.example"
+port = 8_080
+
+[profiles."my laptop"]
+jobs = 2
+`))
+	if err != nil {
+		t.Fatalf("ParseConfig error: %v", err)
+	}
+	wantSettings := map[string][]string{
+		"model":       {"granite4:3b-h"},
+		"temperature": {"0.2"},
+		"dry-run":     {"true"},
+		"prefilter":   {"a,b", "c#d", `say "hi"`},
+	}
+	if !reflect.DeepEqual(config.Settings, wantSettings) {
+		t.Fatalf("Settings = %v, want %v", config.Settings, wantSettings)
+	}
+	if got := config.Profiles["work"]["port"]; !reflect.DeepEqual(got, []string{"8080"}) {
+		t.Fatalf("work port = %v", got)
+	}
+	if _, ok := config.Profiles["my laptop"]; !ok {
+		t.Fatalf("quoted profile name not parsed: %v", config.Profiles)
+	}
+
+	settings, err := config.Profile("work")
+	if err != nil {
+		t.Fatalf("Profile error: %v", err)
+	}
+	if settings["host"][0] != "ollama.corp.example" || settings["model"][0] != "granite4:3b-h" {
+		t.Fatalf("profile settings = %v", settings)
+	}
+	if _, err := config.Profile("home"); err == nil || !strings.Contains(err.Error(), "available: my laptop, work") {
+		t.Fatalf("expected unknown profile error, got %v", err)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"bare string":   "model = granite",
+		"bad table":     "[servers.work]",
+		"unclosed":      "[profiles.work",
+		"duplicate key": "model = \"a\"\nmodel = \"b\"",
+		"duplicate":     "[profiles.a]\n[profiles.a]",
+		"no value":      "model",
+		"open array":    "prefilter = [\"a\"",
+	}
+	for name, text := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseConfig(strings.NewReader(text)); err == nil {
+				t.Fatalf("expected error for %q", text)
+			}
+		})
+	}
+}
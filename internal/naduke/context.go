@@ -0,0 +1,185 @@
+package naduke
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// defaultContextLength is the context Ollama gives a model whose
+	// parameters do not set num_ctx, whatever the model was trained for.
+	defaultContextLength = 2048
+	// answerTokens is kept free in the context for the model's answer.
+	answerTokens = 64
+)
+
+// contextCache holds the context length probed once per model.
+type contextCache struct {
+	mu     sync.Mutex
+	models map[string]*modelContext
+	// warned lists the models a trimmed sample was already reported for.
+	warned map[string]bool
+}
+
+type modelContext struct {
+	once   sync.Once
+	length int
+}
+
+type showResponse struct {
+	Parameters   string         `json:"parameters"`
+	ModelInfo    map[string]any `json:"model_info"`
+	Capabilities []string       `json:"capabilities"`
+}
+
+// contextLength returns the context, in tokens, the server gives model: the
+// num_ctx from -options-json, else the one in the model's parameters, else
+// the smaller of the model's trained context and defaultContextLength. It
+// returns 0 when the client does not probe or /api/show does not say.
+func (c *client) contextLength(opts Options, model string) int {
+	if n, ok := intOption(opts.ExtraOptions["num_ctx"]); ok && n > 0 {
+		return n
+	}
+	if c.contexts == nil {
+		return 0
+	}
+	c.contexts.mu.Lock()
+	if c.contexts.models == nil {
+		c.contexts.models = map[string]*modelContext{}
+	}
+	entry, ok := c.contexts.models[model]
+	if !ok {
+		entry = &modelContext{}
+		c.contexts.models[model] = entry
+	}
+	c.contexts.mu.Unlock()
+	entry.once.Do(func() {
+		entry.length = c.probeContext(model)
+	})
+	return entry.length
+}
+
+func (c *client) probeContext(model string) int {
+	decoded, err := c.show(model)
+	if err != nil {
+		slog.Debug("probe model context", "model", model, "error", err)
+		return 0
+	}
+	length := parseContextLength(decoded)
+	slog.Debug("model context", "model", model, "tokens", length)
+	return length
+}
+
+// show asks /api/show about model.
+func (c *client) show(model string) (showResponse, error) {
+	uri := *c.uri
+	uri.Path = "/api/show"
+	payload, err := json.Marshal(map[string]string{"model": model})
+	if err != nil {
+		return showResponse{}, fmt.Errorf("marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(c.context(), http.MethodPost, uri.String(), bytes.NewReader(payload))
+	if err != nil {
+		return showResponse{}, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return showResponse{}, fmt.Errorf("request model info: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return showResponse{}, c.modelNotFound(model)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return showResponse{}, &ModelRequestError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	var decoded showResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return showResponse{}, fmt.Errorf("%w: decode model info: %v", ErrModelRequestFailed, err)
+	}
+	return decoded, nil
+}
+
+// parseContextLength reads the context length out of an /api/show answer.
+func parseContextLength(show showResponse) int {
+	for _, line := range strings.Split(show.Parameters, "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "num_ctx" {
+			if n, err := strconv.Atoi(fields[1]); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+	for key, value := range show.ModelInfo {
+		if n, ok := intOption(value); ok && n > 0 && strings.HasSuffix(key, ".context_length") {
+			return min(n, defaultContextLength)
+		}
+	}
+	return 0
+}
+
+// intOption converts a number decoded from JSON to an int.
+func intOption(value any) (int, bool) {
+	switch v := value.(type) {
+	case float64:
+		return int(v), true
+	case int:
+		return v, true
+	}
+	return 0, false
+}
+
+// fitContext trims content so the messages around it, content itself and the
+// answer fit in the smallest context of models. others holds the messages
+// sent besides content, whose length counts against the context too. The
+// first trim for each model is logged as a warning.
+func (c *client) fitContext(opts Options, path string, models []string, others []chatMessage, content string) string {
+	length, limiting := 0, ""
+	for _, model := range models {
+		if n := c.contextLength(opts, model); n > 0 && (length == 0 || n < length) {
+			length, limiting = n, model
+		}
+	}
+	if length == 0 {
+		return content
+	}
+	budget := length - answerTokens
+	for _, message := range others {
+		budget -= EstimateTokens(message.Content)
+	}
+	if EstimateTokens(content) <= budget {
+		return content
+	}
+	runes := []rune(content)
+	keep := min(len(runes), max(0, budget*4))
+	if c.firstTrim(limiting) {
+		slog.Warn("sample exceeds the model's context; trimming it", "model", limiting, "context_tokens", length, "path", path, "kept_runes", keep)
+	}
+	slog.Debug("trim sample to context", "path", path, "model", limiting, "runes", keep)
+	return string(runes[:keep])
+}
+
+// firstTrim reports whether no sample was trimmed for model before.
+func (c *client) firstTrim(model string) bool {
+	if c.contexts == nil {
+		return true
+	}
+	c.contexts.mu.Lock()
+	defer c.contexts.mu.Unlock()
+	if c.contexts.warned[model] {
+		return false
+	}
+	if c.contexts.warned == nil {
+		c.contexts.warned = map[string]bool{}
+	}
+	c.contexts.warned[model] = true
+	return true
+}
@@ -0,0 +1,96 @@
+package naduke
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseContextLength(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		show showResponse
+		want int
+	}{
+		{"num_ctx parameter", showResponse{Parameters: "stop \"<|im_end|>\"\nnum_ctx                        8192", ModelInfo: map[string]any{"llama.context_length": float64(131072)}}, 8192},
+		{"trained context above the default", showResponse{ModelInfo: map[string]any{"qwen2.context_length": float64(32768)}}, defaultContextLength},
+		{"trained context below the default", showResponse{ModelInfo: map[string]any{"gemma.context_length": float64(1024)}}, 1024},
+		{"unknown", showResponse{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseContextLength(tt.show); got != tt.want {
+				t.Fatalf("parseContextLength() = %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateNameFitsContext(t *testing.T) {
+	t.Parallel()
+
+	var shows atomic.Int32
+	var sent string
+	fakeTransport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := `{"message":{"role":"assistant","content":"name"}}`
+		switch req.URL.Path {
+		case "/api/show":
+			var payload struct{ Model string }
+			if err := json.NewDecoder(req.Body).Decode(&payload); err != nil || payload.Model != "tiny" {
+				t.Fatalf("unexpected show request: %+v, %v", payload, err)
+			}
+			shows.Add(1)
+			body = `{"parameters":"num_ctx 400","model_info":{"llama.context_length":4096}}`
+		case "/api/chat":
+			var payload chatRequest
+			if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+				t.Fatalf("decode request: %v", err)
+			}
+			sent = payload.Messages[len(payload.Messages)-1].Content
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: make(http.Header)}, nil
+	})
+	client := &client{
+		http:     &http.Client{Transport: fakeTransport},
+		uri:      &url.URL{Scheme: "http", Host: "example.com", Path: "/api/chat"},
+		contexts: &contextCache{},
+	}
+
+	content := strings.Repeat("x", 1000)
+	opts := Options{Model: "tiny", FitContext: true}
+	for i := 0; i < 2; i++ {
+		if _, err := client.GenerateName(opts, "note.txt", content); err != nil {
+			t.Fatalf("GenerateName error: %v", err)
+		}
+		if strings.Contains(sent, content) || !strings.Contains(sent, "xxxx") {
+			t.Fatalf("sample should be trimmed to the 400-token context: %d runes sent", len(sent))
+		}
+		if EstimateTokens(systemMessage(opts, ProfileProse))+EstimateTokens(sent)+answerTokens > 400 {
+			t.Fatalf("request does not fit the context: %q", sent)
+		}
+	}
+	if shows.Load() != 1 {
+		t.Fatalf("context length should be probed once per model, got %d probes", shows.Load())
+	}
+
+	if _, err := client.GenerateName(Options{Model: "tiny"}, "note.txt", content); err != nil {
+		t.Fatalf("GenerateName error: %v", err)
+	}
+	if !strings.Contains(sent, content) {
+		t.Fatalf("sample trimmed without -fit-context")
+	}
+
+	opts.ExtraOptions = map[string]any{"num_ctx": float64(8192)}
+	if _, err := client.GenerateName(opts, "note.txt", content); err != nil {
+		t.Fatalf("GenerateName error: %v", err)
+	}
+	if !strings.Contains(sent, content) {
+		t.Fatalf("num_ctx from -options-json should leave room for the whole sample")
+	}
+}
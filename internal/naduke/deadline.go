@@ -0,0 +1,72 @@
+package naduke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultMaxRequestTimeout caps the size-scaled request deadline.
+	DefaultMaxRequestTimeout = 5 * time.Minute
+	// timeoutStep is the file size that adds another opts.RequestTimeout to
+	// a request's deadline.
+	timeoutStep = 1 << 20
+)
+
+// RequestDeadline returns how long one model request for a file of size bytes
+// may take: opts.RequestTimeout, plus as much again for every MiB, so small
+// files fail fast while large ones get more time. The result never exceeds
+// opts.MaxRequestTimeout when that is set. Zero means no deadline.
+func RequestDeadline(size int64, opts Options) time.Duration {
+	if opts.RequestTimeout <= 0 {
+		return 0
+	}
+	timeout := opts.RequestTimeout + time.Duration(float64(opts.RequestTimeout)*float64(max(size, 0))/timeoutStep)
+	if opts.MaxRequestTimeout > 0 && timeout > opts.MaxRequestTimeout {
+		return opts.MaxRequestTimeout
+	}
+	return timeout
+}
+
+// withRequestTimeout returns a copy of c whose requests each get the
+// RequestDeadline for size bytes.
+func (c *client) withRequestTimeout(opts Options, size int64) *client {
+	timeout := RequestDeadline(size, opts)
+	if timeout == c.requestTimeout {
+		return c
+	}
+	copied := *c
+	copied.requestTimeout = timeout
+	return &copied
+}
+
+// fileSize returns the size of path, or 0 when it cannot be stat'ed.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// requestContext returns the context for one request: c.context() bounded by
+// c.requestTimeout when it is set.
+func (c *client) requestContext() (context.Context, context.CancelFunc) {
+	if c.requestTimeout <= 0 {
+		return c.context(), func() {}
+	}
+	return context.WithTimeout(c.context(), c.requestTimeout)
+}
+
+// timedOut turns err into a failed model request when ctx, from
+// requestContext, ran out of time while the run itself goes on. Other errors
+// are returned as they are.
+func (c *client) timedOut(ctx context.Context, err error) error {
+	if c.requestTimeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) && c.context().Err() == nil {
+		return fmt.Errorf("%w: no answer within %s", ErrModelRequestFailed, c.requestTimeout)
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package naduke
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestDeadline(t *testing.T) {
+	t.Parallel()
+
+	opts := Options{RequestTimeout: 30 * time.Second, MaxRequestTimeout: 2 * time.Minute}
+	tests := []struct {
+		name string
+		size int64
+		opts Options
+		want time.Duration
+	}{
+		{"empty", 0, opts, 30 * time.Second},
+		{"half MiB", 512 << 10, opts, 45 * time.Second},
+		{"two MiB", 2 << 20, opts, 90 * time.Second},
+		{"capped", 100 << 20, opts, 2 * time.Minute},
+		{"no ceiling", 10 << 20, Options{RequestTimeout: time.Second}, 11 * time.Second},
+		{"off", 10 << 20, Options{MaxRequestTimeout: time.Minute}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RequestDeadline(tt.size, tt.opts); got != tt.want {
+				t.Fatalf("RequestDeadline(%d) = %s, want %s", tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateNameRequestTimeoutFallsBack(t *testing.T) {
+	t.Parallel()
+
+	fakeTransport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		var payload chatRequest
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if payload.Model == "slow" {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"message":{"role":"assistant","content":"meeting_notes"}}`)),
+			Header:     make(http.Header),
+		}, nil
+	})
+	client := &client{
+		http: &http.Client{Transport: fakeTransport},
+		uri:  &url.URL{Scheme: "http", Host: "example.com", Path: "/api/chat"},
+	}
+
+	opts := Options{Model: "slow", FallbackModels: []string{"fast"}, RequestTimeout: 10 * time.Millisecond}
+	name, err := client.GenerateName(opts, "missing.txt", "content")
+	if err != nil || name != "meeting_notes" {
+		t.Fatalf("GenerateName = %q, %v; want the fallback answer", name, err)
+	}
+
+	opts.FallbackModels = nil
+	_, err = client.GenerateName(opts, "missing.txt", "content")
+	if !errors.Is(err, ErrModelRequestFailed) || !IsModelError(err) {
+		t.Fatalf("expected a failed model request, got %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package naduke
+
+import (
+	"strings"
+	"unicode"
+)
+
+// emojiParts are the code points that join, modify or tag emoji without being
+// symbols themselves.
+var emojiParts = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x200d, Hi: 0x200d, Stride: 1}, // zero width joiner
+		{Lo: 0x20e3, Hi: 0x20e3, Stride: 1}, // combining enclosing keycap
+		{Lo: 0xfe0e, Hi: 0xfe0f, Stride: 1}, // text and emoji variation selectors
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f3fb, Hi: 0x1f3ff, Stride: 1}, // skin tone modifiers
+		{Lo: 0xe0020, Hi: 0xe007f, Stride: 1}, // tag characters of flag sequences
+	},
+}
+
+// StripEmoji removes emoji and other symbols (Unicode category So, such as
+// ★, ✔ or ©) from text, along with the joiners, variation selectors and
+// modifiers that build emoji sequences. Letters, digits, punctuation and math
+// or currency signs are kept.
+func StripEmoji(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.So, r) || unicode.Is(emojiParts, r) {
+			return -1
+		}
+		return r
+	}, text)
+}
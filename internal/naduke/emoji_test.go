@@ -0,0 +1,72 @@
+package naduke
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStripEmoji(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "meeting notes", "meeting notes"},
+		{"emoji", "party 🎉🎉 time 😀", "party  time "},
+		{"sequence", "team 👩🏽‍💻 and 🇯🇵 flag", "team  and  flag"},
+		{"variation selector", "love ❤️ it", "love  it"},
+		{"symbols", "★ rated © 2024", " rated  2024"},
+		{"kept", "a+b=c, $5 & 50% — ok?", "a+b=c, $5 & 50% — ok?"},
+		{"cjk", "会議の議事録", "会議の議事録"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripEmoji(tt.in); got != tt.want {
+				t.Fatalf("StripEmoji(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSampleStripEmoji(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "chat.txt")
+	text := strings.Repeat("🔥😂👍", 400) + "launch party plans"
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	sample, err := ReadSample(path, Options{StripEmoji: true})
+	if err != nil {
+		t.Fatalf("ReadSample error: %v", err)
+	}
+	if sample != "launch party plans" {
+		t.Fatalf("sample = %q, want the text without emoji", sample)
+	}
+	sample, err = ReadSample(path, Options{})
+	if err != nil {
+		t.Fatalf("ReadSample error: %v", err)
+	}
+	if strings.Contains(sample, "launch") {
+		t.Fatalf("emoji should fill the sample without -strip-emoji: %q", sample)
+	}
+}
+
+func TestSuggestionStripEmoji(t *testing.T) {
+	t.Parallel()
+
+	opts := Options{StripEmoji: true}
+	if name, err := ValidateFor(opts, "🎉party_plan🎉"); err != nil || name != "party_plan" {
+		t.Fatalf("ValidateFor = %q, %v; want party_plan", name, err)
+	}
+	if got := SanitizeSuggestion("🎉 Party Plan ✨", opts); got != "party_plan" {
+		t.Fatalf("SanitizeSuggestion = %q, want party_plan", got)
+	}
+	if _, err := ValidateFor(Options{}, "🎉party_plan🎉"); err == nil {
+		t.Fatal("emoji should be invalid without -strip-emoji")
+	}
+}
@@ -0,0 +1,50 @@
+package naduke
+
+import "fmt"
+
+// Strategies for -on-empty, applied to a file whose sample is empty, such as
+// a zero-byte file.
+const (
+	// EmptyAsk sends the empty sample to the model like any other.
+	EmptyAsk = "ask"
+	// EmptySkip leaves the file alone without asking the model.
+	EmptySkip = "skip"
+	// EmptyNameDefault names the file opts.EmptyName without asking the
+	// model.
+	EmptyNameDefault = "name-default"
+	// EmptyError fails the file with ErrEmptySample.
+	EmptyError = "error"
+)
+
+// DefaultEmptyName is the -empty-name given to empty files by
+// EmptyNameDefault.
+const DefaultEmptyName = "empty_file"
+
+// ParseOnEmpty validates an -on-empty value.
+func ParseOnEmpty(value string) error {
+	switch value {
+	case EmptyAsk, EmptySkip, EmptyNameDefault, EmptyError:
+		return nil
+	default:
+		return fmt.Errorf("unknown empty-file strategy %q (want %s, %s, %s or %s)", value, EmptyAsk, EmptySkip, EmptyNameDefault, EmptyError)
+	}
+}
+
+// FilterEmpty drops files whose sample is empty when opts.OnEmpty is
+// EmptySkip. Files that cannot be sampled are kept so the usual error is
+// reported when they are named.
+func FilterEmpty(files []string, opts Options) ([]string, []SkippedFile) {
+	if opts.OnEmpty != EmptySkip {
+		return files, nil
+	}
+	kept := make([]string, 0, len(files))
+	var skipped []SkippedFile
+	for _, path := range files {
+		if sample, err := ReadSample(path, opts); err == nil && sample == "" {
+			skipped = append(skipped, SkippedFile{path, "empty file"})
+			continue
+		}
+		kept = append(kept, path)
+	}
+	return kept, skipped
+}
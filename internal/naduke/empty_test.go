@@ -0,0 +1,40 @@
+package naduke
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFilterEmpty(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.txt")
+	full := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := os.WriteFile(full, []byte("notes"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	missing := filepath.Join(dir, "missing.txt")
+	files := []string{empty, full, missing}
+
+	kept, skipped := FilterEmpty(files, Options{OnEmpty: EmptyAsk})
+	if !slices.Equal(kept, files) || skipped != nil {
+		t.Fatalf("-on-empty ask filtered files: kept %v, skipped %v", kept, skipped)
+	}
+	kept, skipped = FilterEmpty(files, Options{OnEmpty: EmptySkip})
+	if want := []string{full, missing}; !slices.Equal(kept, want) {
+		t.Fatalf("kept = %v; want %v", kept, want)
+	}
+	if len(skipped) != 1 || skipped[0].Path != empty {
+		t.Fatalf("skipped = %v; want %s", skipped, empty)
+	}
+
+	if err := ParseOnEmpty("ignore"); err == nil {
+		t.Fatal("expected error for an unknown strategy")
+	}
+}
@@ -0,0 +1,75 @@
+package naduke
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encodings for -sample-encoding.
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingLatin1  = "latin1"
+)
+
+// encodingAliases maps accepted -sample-encoding spellings to their encoding.
+var encodingAliases = map[string]string{
+	"utf-8":      EncodingUTF8,
+	"utf8":       EncodingUTF8,
+	"utf-16le":   EncodingUTF16LE,
+	"utf16le":    EncodingUTF16LE,
+	"utf-16be":   EncodingUTF16BE,
+	"utf16be":    EncodingUTF16BE,
+	"latin1":     EncodingLatin1,
+	"latin-1":    EncodingLatin1,
+	"iso-8859-1": EncodingLatin1,
+}
+
+// ParseSampleEncoding returns the encoding named by a -sample-encoding value.
+// An empty value means EncodingUTF8.
+func ParseSampleEncoding(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return EncodingUTF8, nil
+	}
+	if encoding, ok := encodingAliases[value]; ok {
+		return encoding, nil
+	}
+	return "", fmt.Errorf("unknown sample encoding %q (want %s, %s, %s or %s)", value, EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE, EncodingLatin1)
+}
+
+// DecodeSample converts buf from encoding to UTF-8. A byte order mark is
+// dropped, and so is an incomplete code unit or surrogate pair left at the
+// end by a byte-limited read. UTF-8 and unknown encodings are returned as
+// is.
+func DecodeSample(buf []byte, encoding string) []byte {
+	switch encoding {
+	case EncodingUTF16LE, EncodingUTF16BE:
+		units := make([]uint16, 0, len(buf)/2)
+		for i := 0; i+1 < len(buf); i += 2 {
+			if encoding == EncodingUTF16LE {
+				units = append(units, uint16(buf[i])|uint16(buf[i+1])<<8)
+			} else {
+				units = append(units, uint16(buf[i])<<8|uint16(buf[i+1]))
+			}
+		}
+		if len(units) > 0 && units[0] == 0xfeff {
+			units = units[1:]
+		}
+		if n := len(units); n > 0 && utf16.IsSurrogate(rune(units[n-1])) && units[n-1] < 0xdc00 {
+			units = units[:n-1]
+		}
+		return []byte(string(utf16.Decode(units)))
+	case EncodingLatin1:
+		out := make([]byte, 0, len(buf)*2)
+		for _, b := range buf {
+			out = utf8.AppendRune(out, rune(b))
+		}
+		return out
+	default:
+		return buf
+	}
+}
@@ -0,0 +1,84 @@
+package naduke
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func utf16Bytes(s string, bigEndian bool) []byte {
+	var out []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		if bigEndian {
+			out = append(out, byte(u>>8), byte(u))
+		} else {
+			out = append(out, byte(u), byte(u>>8))
+		}
+	}
+	return out
+}
+
+func TestReadSampleEncoding(t *testing.T) {
+	t.Parallel()
+
+	text := "Réunion trimestrielle — 会議 🎉\n"
+	tests := []struct {
+		encoding string
+		content  []byte
+		want     string
+	}{
+		{EncodingUTF16LE, append([]byte{0xff, 0xfe}, utf16Bytes(text, false)...), text},
+		{EncodingUTF16BE, utf16Bytes(text, true), text},
+		{EncodingLatin1, []byte("caf\xe9 cr\xe8me\n"), "café crème\n"},
+		{EncodingUTF8, []byte(text), text},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.encoding+".txt")
+		if err := os.WriteFile(path, tt.content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sample, err := ReadSample(path, Options{SampleEncoding: tt.encoding})
+		if err != nil {
+			t.Fatalf("ReadSample(%s): %v", tt.encoding, err)
+		}
+		if sample != tt.want {
+			t.Fatalf("ReadSample(%s) = %q; want %q", tt.encoding, sample, tt.want)
+		}
+		if _, err := EnsureTextSample(sample, path); err != nil {
+			t.Fatalf("decoded %s sample rejected: %v", tt.encoding, err)
+		}
+	}
+
+	// A long UTF-16 file is cut to the usual number of runes, without a
+	// broken character at the end.
+	path := filepath.Join(dir, "long.txt")
+	if err := os.WriteFile(path, utf16Bytes(strings.Repeat("🎉", 3000), false), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []Options{{SampleEncoding: EncodingUTF16LE}, {SampleEncoding: EncodingUTF16LE, NormalizeWhitespace: true}} {
+		sample, err := ReadSample(path, opts)
+		if err != nil {
+			t.Fatalf("ReadSample: %v", err)
+		}
+		if sample != strings.Repeat("🎉", readChars) {
+			t.Fatalf("long sample has %d runes, starting %q", len([]rune(sample)), []rune(sample)[:2])
+		}
+	}
+}
+
+func TestParseSampleEncoding(t *testing.T) {
+	t.Parallel()
+
+	for value, want := range map[string]string{"": EncodingUTF8, "UTF-16LE": EncodingUTF16LE, "iso-8859-1": EncodingLatin1} {
+		if got, err := ParseSampleEncoding(value); err != nil || got != want {
+			t.Fatalf("ParseSampleEncoding(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+	_, err := ParseSampleEncoding("shift-jis")
+	if err == nil || !strings.Contains(err.Error(), "utf-16le") {
+		t.Fatalf("expected an error listing the supported encodings, got %v", err)
+	}
+}
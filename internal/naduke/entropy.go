@@ -0,0 +1,72 @@
+package naduke
+
+import (
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+// minEntropyRunes is the sample length below which no entropy verdict is
+// made; short samples do not have enough characters to tell.
+const minEntropyRunes = 64
+
+// SampleEntropy returns the Shannon entropy of sample in bits per character.
+// Prose and source code usually stay below 5; base64 and other encoded blobs
+// approach 6.
+func SampleEntropy(sample string) float64 {
+	counts := map[rune]int{}
+	total := 0
+	for _, r := range sample {
+		counts[r]++
+		total++
+	}
+	entropy := 0.0
+	for _, n := range counts {
+		p := float64(n) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// looksEncoded reports whether sample is mostly ASCII with an entropy above
+// threshold. Samples in scripts with large alphabets, such as CJK, naturally
+// have a high character entropy and are never flagged.
+func looksEncoded(sample string, threshold float64) (float64, bool) {
+	runes, ascii := 0, 0
+	for _, r := range sample {
+		runes++
+		if r < utf8.RuneSelf {
+			ascii++
+		}
+	}
+	if runes < minEntropyRunes || ascii*2 < runes {
+		return 0, false
+	}
+	entropy := SampleEntropy(sample)
+	return entropy, entropy > threshold
+}
+
+// FilterEntropy splits files into those kept and those whose sample looks
+// like encoded or random data under opts.EntropyThreshold. A threshold of zero
+// keeps every file. Files that cannot be sampled are kept so the usual error
+// is reported when they are named.
+func FilterEntropy(files []string, opts Options) ([]string, []SkippedFile) {
+	if opts.EntropyThreshold <= 0 {
+		return files, nil
+	}
+	kept := make([]string, 0, len(files))
+	var skipped []SkippedFile
+	for _, path := range files {
+		sample, err := ReadSample(path, opts)
+		if err != nil {
+			kept = append(kept, path)
+			continue
+		}
+		if entropy, ok := looksEncoded(sample, opts.EntropyThreshold); ok {
+			skipped = append(skipped, SkippedFile{path, fmt.Sprintf("entropy %.2f bits/char is above -entropy-threshold %.2f", entropy, opts.EntropyThreshold)})
+			continue
+		}
+		kept = append(kept, path)
+	}
+	return kept, skipped
+}
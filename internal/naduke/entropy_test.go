@@ -0,0 +1,58 @@
+package naduke
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSampleEntropy(t *testing.T) {
+	t.Parallel()
+
+	if got := SampleEntropy(strings.Repeat("a", 100)); got != 0 {
+		t.Fatalf("entropy of a single repeated rune = %v; want 0", got)
+	}
+	if got := SampleEntropy("abab"); got != 1 {
+		t.Fatalf("entropy of two equally common runes = %v; want 1", got)
+	}
+}
+
+func TestFilterEntropy(t *testing.T) {
+	t.Parallel()
+
+	random := make([]byte, 3000)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"blob.txt":  base64.StdEncoding.EncodeToString(random),
+		"notes.txt": strings.Repeat("The quarterly review is scheduled for Friday. Please bring your notes and the budget draft.\n", 20),
+		"code.go":   strings.Repeat("func main() {\n\tfor i := 0; i < 10; i++ {\n\t\tfmt.Println(i)\n\t}\n}\n", 20),
+		"kanji.txt": strings.Repeat("四半期の見直しは金曜日に予定されています。議事録と予算案を持ってきてください。", 20),
+		"short.txt": "Zm9vYmFyYmF6cXV4",
+	}
+	var paths []string
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	kept, skipped := FilterEntropy(paths, Options{EntropyThreshold: 5.5})
+	if len(skipped) != 1 || filepath.Base(skipped[0].Path) != "blob.txt" {
+		t.Fatalf("expected only blob.txt skipped, got %+v", skipped)
+	}
+	if len(kept) != len(paths)-1 {
+		t.Fatalf("expected %d files kept, got %v", len(paths)-1, kept)
+	}
+
+	if kept, skipped := FilterEntropy(paths, Options{}); len(kept) != len(paths) || skipped != nil {
+		t.Fatalf("zero threshold should keep every file, got %v / %+v", kept, skipped)
+	}
+}
@@ -0,0 +1,111 @@
+package naduke
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// Sentinel errors let callers tell failure categories apart with errors.Is.
+var (
+	ErrNotText            = errors.New("not a text file")
+	ErrEmptySample        = errors.New("empty sample")
+	ErrDestinationExists  = errors.New("destination already exists")
+	ErrModelEmptyResponse = errors.New("empty response from model")
+	ErrModelNotFound      = errors.New("model not found")
+	ErrModelRequestFailed = errors.New("model request failed")
+	ErrInvalidSuggestion  = errors.New("invalid suggestion")
+	ErrNotWritable        = errors.New("destination directory not writable")
+	ErrUnsafeName         = errors.New("unsafe file name")
+	ErrBatchMismatch      = errors.New("batch answer does not match the files")
+	ErrRepeatedNames      = errors.New("model keeps suggesting the same name")
+	ErrMissingCapability  = errors.New("model lacks a required capability")
+)
+
+// Policies for -on-model-error and -on-fs-error.
+const (
+	ErrorContinue = "continue"
+	ErrorAbort    = "abort"
+)
+
+// ParseErrorPolicy validates an -on-model-error or -on-fs-error value.
+func ParseErrorPolicy(value string) error {
+	switch value {
+	case ErrorContinue, ErrorAbort:
+		return nil
+	default:
+		return fmt.Errorf("unknown error policy %q (want %s or %s)", value, ErrorContinue, ErrorAbort)
+	}
+}
+
+// IsModelError reports whether err comes from talking to the model: a failed
+// or empty response, a missing model or capability, a transport error or the
+// same answer for every file.
+func IsModelError(err error) bool {
+	var urlErr *url.Error
+	return errors.Is(err, ErrModelRequestFailed) ||
+		errors.Is(err, ErrRepeatedNames) ||
+		errors.Is(err, ErrModelNotFound) ||
+		errors.Is(err, ErrMissingCapability) ||
+		errors.Is(err, ErrModelEmptyResponse) ||
+		errors.As(err, &urlErr)
+}
+
+// IsFilesystemError reports whether err comes from the filesystem: a taken or
+// unwritable destination, or a failed file operation.
+func IsFilesystemError(err error) bool {
+	var pathErr *os.PathError
+	var linkErr *os.LinkError
+	return errors.Is(err, ErrDestinationExists) ||
+		errors.Is(err, ErrNotWritable) ||
+		errors.As(err, &pathErr) ||
+		errors.As(err, &linkErr)
+}
+
+// ModelRequestError reports a non-2xx response from the Ollama server. It
+// matches ErrModelRequestFailed with errors.Is.
+type ModelRequestError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ModelRequestError) Error() string {
+	return fmt.Sprintf("model request failed (%d): %s", e.StatusCode, e.Body)
+}
+
+func (e *ModelRequestError) Is(target error) bool {
+	return target == ErrModelRequestFailed
+}
+
+// Reasons a SuggestionError gives for rejecting a model answer.
+const (
+	ReasonEmpty        = "empty"
+	ReasonTooLong      = "too long"
+	ReasonInvalidChars = "invalid characters"
+	ReasonPath         = "path or URL"
+)
+
+// SuggestionError reports why a model answer failed validation. It matches
+// ErrInvalidSuggestion with errors.Is.
+type SuggestionError struct {
+	Raw    string
+	Reason string
+}
+
+func (e *SuggestionError) Error() string {
+	switch e.Reason {
+	case ReasonEmpty:
+		return fmt.Sprintf("invalid suggestion: %q is empty", e.Raw)
+	case ReasonPath:
+		return fmt.Sprintf("invalid suggestion: %q is a path or URL", e.Raw)
+	case ReasonTooLong:
+		return fmt.Sprintf("invalid suggestion: %q is longer than %d characters", e.Raw, maxNameLength)
+	default:
+		return fmt.Sprintf("invalid suggestion: %q does not match required pattern %s", e.Raw, namePattern.String())
+	}
+}
+
+func (e *SuggestionError) Is(target error) bool {
+	return target == ErrInvalidSuggestion
+}
@@ -0,0 +1,26 @@
+package naduke
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestModelRequestError(t *testing.T) {
+	t.Parallel()
+
+	err := fmt.Errorf("naming note.txt: %w", &ModelRequestError{StatusCode: 503, Body: "busy"})
+	if !errors.Is(err, ErrModelRequestFailed) {
+		t.Fatalf("wrapped ModelRequestError should match ErrModelRequestFailed")
+	}
+	var reqErr *ModelRequestError
+	if !errors.As(err, &reqErr) || reqErr.StatusCode != 503 {
+		t.Fatalf("expected status code 503, got %+v", reqErr)
+	}
+	if errors.Is(err, ErrModelEmptyResponse) {
+		t.Fatalf("ModelRequestError should not match unrelated sentinels")
+	}
+	if got := reqErr.Error(); got != "model request failed (503): busy" {
+		t.Fatalf("unexpected message: %q", got)
+	}
+}
@@ -0,0 +1,49 @@
+package naduke
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Example is a few-shot pair shown to the model before the real file: a
+// content snippet and the name it should get. Path is only needed with
+// BaseNameOnly, where the prompt includes the current name.
+type Example struct {
+	Content string `json:"content"`
+	Name    string `json:"name"`
+	Path    string `json:"path,omitempty"`
+}
+
+// ParseExamples reads a JSON array of examples, as written for
+// -examples-file, and checks every name against the naming rules for opts.
+func ParseExamples(r io.Reader, opts Options) ([]Example, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var examples []Example
+	if err := dec.Decode(&examples); err != nil {
+		return nil, fmt.Errorf("invalid examples: %w", err)
+	}
+	for i, example := range examples {
+		if strings.TrimSpace(example.Content) == "" {
+			return nil, fmt.Errorf("example %d: content is empty", i+1)
+		}
+		if _, err := ValidateFor(opts, example.Name); err != nil {
+			return nil, fmt.Errorf("example %d: %w", i+1, err)
+		}
+	}
+	return examples, nil
+}
+
+// exampleMessages renders opts.Examples as prior user and assistant turns.
+func exampleMessages(opts Options) []chatMessage {
+	messages := make([]chatMessage, 0, 2*len(opts.Examples))
+	for _, example := range opts.Examples {
+		messages = append(messages,
+			chatMessage{Role: "user", Content: userMessage(opts, example.Path, example.Content)},
+			chatMessage{Role: "assistant", Content: example.Name},
+		)
+	}
+	return messages
+}
@@ -0,0 +1,94 @@
+package naduke
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseExamples(t *testing.T) {
+	t.Parallel()
+
+	examples, err := ParseExamples(strings.NewReader(`[
+		{"content": "Agenda: budget, hiring", "name": "q3_planning_meeting"},
+		{"content": "SELECT * FROM users", "name": "user_report_query"}
+	]`), Options{})
+	if err != nil {
+		t.Fatalf("ParseExamples error: %v", err)
+	}
+	if len(examples) != 2 || examples[1].Name != "user_report_query" {
+		t.Fatalf("unexpected examples: %+v", examples)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"invalid name", `[{"content": "x", "name": "Not Valid"}]`},
+		{"empty content", `[{"content": " ", "name": "valid_name"}]`},
+		{"unknown field", `[{"content": "x", "name": "valid_name", "title": "t"}]`},
+		{"not an array", `{"content": "x", "name": "valid_name"}`},
+	}
+	for _, tt := range tests {
+		if _, err := ParseExamples(strings.NewReader(tt.input), Options{}); err == nil {
+			t.Fatalf("%s: expected error", tt.name)
+		}
+	}
+	if _, err := ParseExamples(strings.NewReader(`[{"content": "x", "name": "Not Valid"}]`), Options{}); !errors.Is(err, ErrInvalidSuggestion) {
+		t.Fatalf("expected ErrInvalidSuggestion for a bad example name, got %v", err)
+	}
+	if _, err := ParseExamples(strings.NewReader(`[{"content": "x", "name": "report.csv"}]`), Options{AllowExt: true, AllowedExts: []string{"csv"}}); err != nil {
+		t.Fatalf("example names follow -allow-ext: %v", err)
+	}
+}
+
+func TestGenerateNameSendsExamplesInOrder(t *testing.T) {
+	t.Parallel()
+
+	var messages []chatMessage
+	fakeTransport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		var payload chatRequest
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		messages = payload.Messages
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"message":{"role":"assistant","content":"name"}}`)),
+			Header:     make(http.Header),
+		}, nil
+	})
+	client := &client{
+		http: &http.Client{Transport: fakeTransport},
+		uri:  &url.URL{Scheme: "http", Host: "example.com", Path: "/api/chat"},
+	}
+
+	opts := Options{Model: "m", Examples: []Example{
+		{Content: "first example", Name: "first_name"},
+		{Content: "second example", Name: "second_name"},
+	}}
+	if _, err := client.GenerateName(opts, "real.txt", "real content"); err != nil {
+		t.Fatalf("GenerateName error: %v", err)
+	}
+
+	want := []struct{ role, contains string }{
+		{"system", "file names"},
+		{"user", "first example"},
+		{"assistant", "first_name"},
+		{"user", "second example"},
+		{"assistant", "second_name"},
+		{"user", "real content"},
+	}
+	if len(messages) != len(want) {
+		t.Fatalf("expected %d messages, got %+v", len(want), messages)
+	}
+	for i, w := range want {
+		if messages[i].Role != w.role || !strings.Contains(messages[i].Content, w.contains) {
+			t.Fatalf("message %d = %+v; want role %s containing %q", i, messages[i], w.role, w.contains)
+		}
+	}
+}
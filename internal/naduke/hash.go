@@ -0,0 +1,50 @@
+package naduke
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+)
+
+// Algorithms for -hash-algo, used by content hashes for -on-collision hash,
+// -on-ambiguous hash, -dedupe and the -memory-cache keys. BLAKE3 was asked
+// for but has no standard library implementation, so the fast choice offered
+// instead is SHA-512, often faster than SHA-256 on 64-bit machines.
+const (
+	HashSHA256 = "sha256"
+	HashSHA1   = "sha1"
+	HashSHA512 = "sha512"
+)
+
+// DefaultHashAlgorithm is the -hash-algo used when none is set.
+const DefaultHashAlgorithm = HashSHA256
+
+var hashes = map[string]func() hash.Hash{
+	HashSHA256: sha256.New,
+	HashSHA1:   sha1.New,
+	HashSHA512: sha512.New,
+}
+
+// ParseHashAlgorithm validates a -hash-algo value.
+func ParseHashAlgorithm(value string) error {
+	if _, ok := hashes[value]; ok {
+		return nil
+	}
+	return fmt.Errorf("unknown hash algorithm %q (want %s, %s or %s)", value, HashSHA256, HashSHA1, HashSHA512)
+}
+
+// newHash returns a hash for opts.HashAlgorithm, SHA-256 when it is unset.
+func newHash(opts Options) hash.Hash {
+	if newFunc, ok := hashes[opts.HashAlgorithm]; ok {
+		return newFunc()
+	}
+	return sha256.New()
+}
+
+// HashHexLength returns the number of hex digits of a content hash for opts,
+// the most -hash-length can take.
+func HashHexLength(opts Options) int {
+	return 2 * newHash(opts).Size()
+}
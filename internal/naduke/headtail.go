@@ -0,0 +1,99 @@
+package naduke
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// headTailSeparator joins the start and the end of a head/tail sample, so the
+// model can tell the two parts apart.
+const headTailSeparator = "\n[...]\n"
+
+// ParseHeadTailSplit parses a -head-tail-split value such as "70/30": the
+// percentages of the sample taken from the start and from the end of long
+// files. They must add up to 100. It returns the fraction taken from the
+// start; 1 ("100/0") reads only the start, as without the option.
+func ParseHeadTailSplit(value string) (float64, error) {
+	head, tail, ok := strings.Cut(value, "/")
+	h, errHead := strconv.Atoi(strings.TrimSpace(head))
+	t, errTail := strconv.Atoi(strings.TrimSpace(tail))
+	if !ok || errHead != nil || errTail != nil || h < 0 || t < 0 {
+		return 0, fmt.Errorf("invalid head-tail split %q (want HEAD/TAIL percentages, e.g. 70/30)", value)
+	}
+	if h+t != 100 {
+		return 0, fmt.Errorf("head-tail split %q must add up to 100, not %d", value, h+t)
+	}
+	return float64(h) / 100, nil
+}
+
+// useHeadTail reports whether opts asks for part of the sample from the end
+// of the file.
+func useHeadTail(opts Options) bool {
+	return opts.HeadTailSplit > 0 && opts.HeadTailSplit < 1
+}
+
+// headTailSample builds the sample of a file longer than readChars from its
+// start and its end. The first opts.HeadTailSplit of readChars runes come
+// from text, the decoded and rewritten start of the file; the rest are the
+// last runes of the file. When whole is set, text already holds the entire
+// file; otherwise the end is read from f, starting no earlier than offset so
+// the two parts never overlap. window is the byte budget of a full sample.
+func headTailSample(f *os.File, text []byte, whole bool, offset, window int64, opts Options) (string, error) {
+	runes := []rune(string(text))
+	headRunes := int(math.Round(readChars * opts.HeadTailSplit))
+	tailRunes := readChars - headRunes
+	head := string(runes[:min(headRunes, len(runes))])
+
+	var tail []rune
+	if whole {
+		tail = runes[max(headRunes, len(runes)-tailRunes):]
+	} else {
+		raw, err := readTail(f, offset, window*int64(tailRunes)/readChars, opts.SampleEncoding)
+		if err != nil {
+			return "", err
+		}
+		tail = []rune(rewriteSample(string(raw), opts))
+		tail = tail[max(0, len(tail)-tailRunes):]
+	}
+
+	end := string(tail)
+	if opts.TrimAtSentence {
+		head = TrimToLastSentence(head)
+	} else if opts.TrimAtNewline {
+		head = TrimToLastLine(head)
+		// The end starts mid-line unless it happens to follow a newline.
+		if idx := strings.IndexByte(end, '\n'); idx >= 0 && idx+1 < len(end) {
+			end = end[idx+1:]
+		}
+	}
+	return head + headTailSeparator + end, nil
+}
+
+// readTail reads up to n bytes from the end of f, but not before offset, and
+// decodes them from encoding. The read is aligned so it does not start in
+// the middle of a character.
+func readTail(f *os.File, offset, n int64, encoding string) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	start := max(offset, info.Size()-n)
+	if (encoding == EncodingUTF16LE || encoding == EncodingUTF16BE) && start%2 != 0 {
+		start++
+	}
+	buf := make([]byte, max(0, info.Size()-start))
+	if _, err := f.ReadAt(buf, start); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	if encoding == EncodingUTF8 || encoding == "" {
+		for len(buf) > 0 && !utf8.RuneStart(buf[0]) {
+			buf = buf[1:]
+		}
+	}
+	return DecodeSample(buf, encoding), nil
+}
@@ -0,0 +1,102 @@
+package naduke
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParseHeadTailSplit(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]float64{"70/30": 0.7, "50/50": 0.5, " 100 / 0 ": 1, "0/100": 0}
+	for value, want := range tests {
+		got, err := ParseHeadTailSplit(value)
+		if err != nil || got != want {
+			t.Fatalf("ParseHeadTailSplit(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	for _, bad := range []string{"70", "70/20", "80/30", "-10/110", "a/b", ""} {
+		if _, err := ParseHeadTailSplit(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestReadSampleHeadTail(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	// Long enough that the end lies beyond the window read for the start.
+	content := strings.Repeat("h", 3000) + strings.Repeat("m", 5000) + strings.Repeat("t", 3000)
+	path := filepath.Join(dir, "long.txt")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	short := filepath.Join(dir, "short.txt")
+	shortContent := strings.Repeat("a", 900) + strings.Repeat("z", 300)
+	if err := os.WriteFile(short, []byte(shortContent), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	tests := []struct {
+		split      float64
+		head, tail int
+	}{
+		{0.7, 700, 300},
+		{0.5, 500, 500},
+	}
+	for _, tt := range tests {
+		sample, err := ReadSample(path, Options{HeadTailSplit: tt.split})
+		if err != nil {
+			t.Fatalf("ReadSample error: %v", err)
+		}
+		want := strings.Repeat("h", tt.head) + headTailSeparator + strings.Repeat("t", tt.tail)
+		if sample != want {
+			t.Fatalf("split %v: got %d runes starting %q, want %d head and %d tail runes", tt.split, utf8.RuneCountInString(sample), sample[:10], tt.head, tt.tail)
+		}
+
+		// The whole file fits in the window: the end is taken from what was
+		// read, after the head.
+		sample, err = ReadSample(short, Options{HeadTailSplit: tt.split})
+		if err != nil {
+			t.Fatalf("ReadSample error: %v", err)
+		}
+		if want := shortContent[:tt.head] + headTailSeparator + shortContent[len(shortContent)-tt.tail:]; sample != want {
+			t.Fatalf("split %v: unexpected sample of a file within the window: %q", tt.split, sample)
+		}
+	}
+
+	// Files that fit in the sample are sent whole.
+	small := filepath.Join(dir, "small.txt")
+	if err := os.WriteFile(small, []byte("just a note"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if sample, err := ReadSample(small, Options{HeadTailSplit: 0.7}); err != nil || sample != "just a note" {
+		t.Fatalf("small file should be sent whole, got %q, %v", sample, err)
+	}
+}
+
+func TestReadSampleHeadTailTrimAtNewline(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	content := strings.Repeat("start line\n", 500) + strings.Repeat("end line\n", 500)
+	path := filepath.Join(dir, "lines.txt")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	sample, err := ReadSample(path, Options{HeadTailSplit: 0.7, TrimAtNewline: true})
+	if err != nil {
+		t.Fatalf("ReadSample error: %v", err)
+	}
+	head, tail, ok := strings.Cut(sample, headTailSeparator)
+	if !ok {
+		t.Fatalf("missing separator: %q", sample)
+	}
+	if !strings.HasSuffix(head, "start line\n") || !strings.HasPrefix(tail, "end line\n") || !strings.HasSuffix(tail, "end line\n") {
+		t.Fatalf("head and tail should hold whole lines: %q / %q", head, tail)
+	}
+}
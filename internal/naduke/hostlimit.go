@@ -0,0 +1,83 @@
+package naduke
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// hostLimiter is a transport that caps the requests in flight to each
+// server host. A request holds its slot until its response body is closed,
+// so a slow answer counts against the host for as long as it is read.
+type hostLimiter struct {
+	next http.RoundTripper
+	// limits maps a host, as "name:port" or "name", to its cap; hosts not
+	// listed use fallback. A cap below 1 means no limit.
+	limits   map[string]int
+	fallback int
+
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+// newHostLimiter wraps next with the caps from opts.HostConcurrency; other
+// hosts get opts.Jobs.
+func newHostLimiter(next http.RoundTripper, opts Options) *hostLimiter {
+	return &hostLimiter{next: next, limits: opts.HostConcurrency, fallback: opts.Jobs, slots: map[string]chan struct{}{}}
+}
+
+// slot returns the semaphore for the host of req, or nil when it is unlimited.
+func (l *hostLimiter) slot(req *http.Request) chan struct{} {
+	host := strings.ToLower(req.URL.Host)
+	limit, ok := l.limits[host]
+	if !ok {
+		limit, ok = l.limits[strings.ToLower(req.URL.Hostname())]
+	}
+	if !ok {
+		limit = l.fallback
+	}
+	if limit < 1 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sem, ok := l.slots[host]
+	if !ok {
+		sem = make(chan struct{}, limit)
+		l.slots[host] = sem
+	}
+	return sem
+}
+
+func (l *hostLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	sem := l.slot(req)
+	if sem == nil {
+		return l.next.RoundTrip(req)
+	}
+	select {
+	case sem <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	var once sync.Once
+	release := func() { once.Do(func() { <-sem }) }
+	resp, err := l.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releasingBody frees a host slot when the response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,91 @@
+package naduke
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHostLimiter(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	inFlight, peak := map[string]int{}, map[string]int{}
+	next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		inFlight[req.URL.Host]++
+		peak[req.URL.Host] = max(peak[req.URL.Host], inFlight[req.URL.Host])
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight[req.URL.Host]--
+		mu.Unlock()
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+	})
+	limiter := newHostLimiter(next, Options{Jobs: 8, HostConcurrency: map[string]int{"weak:11434": 2, "other": 3}})
+
+	var wg sync.WaitGroup
+	for _, host := range []string{"weak:11434", "strong:11434", "OTHER:8080"} {
+		for i := 0; i < 12; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				req, _ := http.NewRequest(http.MethodPost, "http://"+host+"/api/chat", nil)
+				resp, err := limiter.RoundTrip(req)
+				if err != nil {
+					t.Errorf("RoundTrip error: %v", err)
+					return
+				}
+				resp.Body.Close()
+			}()
+		}
+	}
+	wg.Wait()
+
+	want := map[string]int{"weak:11434": 2, "strong:11434": 8, "OTHER:8080": 3}
+	for host, limit := range want {
+		if peak[host] > limit {
+			t.Fatalf("%s had %d requests in flight; want at most %d", host, peak[host], limit)
+		}
+	}
+}
+
+func TestHostLimiterHoldsSlotUntilBodyClosed(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls.Add(1)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+	})
+	limiter := newHostLimiter(next, Options{Jobs: 1})
+
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost:11434/api/chat", nil)
+	first, err := limiter.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip error: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := limiter.RoundTrip(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	select {
+	case <-done:
+		t.Fatalf("second request ran while the first body was open")
+	case <-time.After(20 * time.Millisecond):
+	}
+	first.Body.Close()
+	first.Body.Close()
+	<-done
+	if calls.Load() != 2 {
+		t.Fatalf("expected 2 requests, got %d", calls.Load())
+	}
+}
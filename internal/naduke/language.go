@@ -0,0 +1,99 @@
+package naduke
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	// languageGuidance is added to the system prompt with the detected
+	// language of the content.
+	languageGuidance = "- The text is written in %s: write the name in %s too, romanized to the letters a-z."
+	// minLanguageHits is the number of stopwords the most frequent language
+	// needs before the detection counts, and minScriptRunes the number of
+	// letters a script needs.
+	minLanguageHits = 3
+	minScriptRunes  = 10
+)
+
+// stopwords are frequent words specific enough to tell the languages apart.
+// Words shared by several of them, such as "de", are left out.
+var stopwords = map[string][]string{
+	"English":    {"the", "and", "of", "to", "that", "for", "with", "this", "are", "was", "be", "it", "on"},
+	"French":     {"le", "la", "les", "des", "est", "et", "une", "du", "pour", "dans", "qui", "sur", "pas", "avec", "nous", "vous", "au", "ce"},
+	"German":     {"der", "die", "das", "und", "ist", "nicht", "mit", "ein", "eine", "ich", "zu", "den", "von", "sie", "auf", "für", "sich", "dem", "wir"},
+	"Spanish":    {"el", "los", "las", "y", "del", "por", "está", "como", "más", "pero", "es", "muy", "hay"},
+	"Italian":    {"il", "di", "che", "è", "per", "non", "sono", "della", "gli", "nel", "anche", "questo", "molto"},
+	"Portuguese": {"o", "os", "não", "uma", "do", "da", "em", "com", "é", "são", "mais", "você"},
+	"Dutch":      {"het", "een", "en", "van", "niet", "dat", "op", "te", "zijn", "voor", "met", "ik", "wordt"},
+}
+
+// DetectLanguage guesses the language of sample. Japanese, Korean and
+// Chinese are told apart by script; languages written in Latin letters by
+// counting stopwords. It reports false when no language clearly stands out,
+// for example in short samples, code or mixed text.
+func DetectLanguage(sample string) (string, bool) {
+	var kana, hangul, han, latin int
+	for _, r := range sample {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+	if cjk := kana + hangul + han; cjk >= minScriptRunes && cjk > latin {
+		switch {
+		case kana > 0 && kana >= hangul:
+			return "Japanese", true
+		case hangul > han:
+			return "Korean", true
+		case hangul == 0:
+			return "Chinese", true
+		}
+		return "", false
+	}
+
+	hits := map[string]int{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(sample), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for language, words := range stopwords {
+			for _, w := range words {
+				if w == word {
+					hits[language]++
+					break
+				}
+			}
+		}
+	}
+	best, second := "", 0
+	for language, n := range hits {
+		if best == "" || n > hits[best] || (n == hits[best] && language < best) {
+			if best != "" {
+				second = max(second, hits[best])
+			}
+			best = language
+		} else {
+			second = max(second, n)
+		}
+	}
+	if best == "" || hits[best] < minLanguageHits || hits[best] < 2*second {
+		return "", false
+	}
+	return best, true
+}
+
+// languageMessage returns the system prompt line asking for a name in the
+// language of content, or "" when the language is unclear or English, which
+// the prompt is written in anyway.
+func languageMessage(content string) string {
+	language, ok := DetectLanguage(content)
+	if !ok || language == "English" {
+		return ""
+	}
+	return fmt.Sprintf(languageGuidance, language, language)
+}
@@ -0,0 +1,97 @@
+package naduke
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		sample string
+		want   string
+		ok     bool
+	}{
+		{"french", "Le rapport annuel est prêt et nous avons envoyé les résultats pour la réunion dans la salle.", "French", true},
+		{"german", "Die Besprechung ist morgen und wir haben den Bericht für das Team mit der Liste.", "German", true},
+		{"english", "The meeting is on Friday and the report for the team is ready with the notes.", "English", true},
+		{"japanese", "これは会議の議事録です。来週の予定について話し合いました。", "Japanese", true},
+		{"korean", "이것은 회의록입니다 다음 주 일정에 대해 논의했습니다", "Korean", true},
+		{"chinese", "这是会议记录我们讨论了下周的计划和预算安排", "Chinese", true},
+		{"short", "Le chat", "", false},
+		{"code", "func main() { fmt.Println(x) }", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := DetectLanguage(tt.sample)
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("DetectLanguage() = %q, %v; want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGenerateNamePromptsLanguageOfContent(t *testing.T) {
+	t.Parallel()
+
+	var system string
+	fakeTransport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		var payload chatRequest
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		system = payload.Messages[0].Content
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"message":{"role":"assistant","content":"rapport_annuel"}}`)),
+			Header:     make(http.Header),
+		}, nil
+	})
+	client := &client{
+		http: &http.Client{Transport: fakeTransport},
+		uri:  &url.URL{Scheme: "http", Host: "example.com", Path: "/api/chat"},
+	}
+
+	french := "Le rapport annuel est prêt et nous avons envoyé les résultats pour la réunion dans la salle."
+	opts := Options{Model: "m", PromptLanguageOfContent: true}
+	if _, err := client.GenerateName(opts, "rapport.txt", french); err != nil {
+		t.Fatalf("GenerateName error: %v", err)
+	}
+	if !strings.Contains(system, "written in French: write the name in French") {
+		t.Fatalf("system prompt lacks the French instruction: %q", system)
+	}
+
+	if _, err := client.GenerateName(opts, "note.txt", "Le chat"); err != nil {
+		t.Fatalf("GenerateName error: %v", err)
+	}
+	if strings.Contains(system, "written in") {
+		t.Fatalf("low-confidence detection should add no instruction: %q", system)
+	}
+
+	if _, err := client.GenerateName(Options{Model: "m"}, "rapport.txt", french); err != nil {
+		t.Fatalf("GenerateName error: %v", err)
+	}
+	if strings.Contains(system, "written in") {
+		t.Fatalf("instruction added without -prompt-language-of-content: %q", system)
+	}
+}
+
+func TestStopwordsAreNotShared(t *testing.T) {
+	t.Parallel()
+
+	seen := map[string]string{}
+	for language, words := range stopwords {
+		for _, w := range words {
+			if other, ok := seen[w]; ok {
+				t.Errorf("%q is a stopword of both %s and %s", w, other, language)
+			}
+			seen[w] = language
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package naduke
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Sources for -content-source: what the sample sent to the model is built
+// from.
+const (
+	// ContentSourceContent samples the file's text.
+	ContentSourceContent = "content"
+	// ContentSourceMetadata samples the tags embedded in audio and image
+	// files; files without tags are skipped.
+	ContentSourceMetadata = "metadata"
+	// ContentSourceAuto samples the tags of files that have them and the
+	// text of the others.
+	ContentSourceAuto = "auto"
+)
+
+// DefaultContentSource is the -content-source used without the flag.
+const DefaultContentSource = ContentSourceContent
+
+// metadataWindow is how much of the start of a file is searched for tags.
+// ID3v2 tags and JPEG EXIF segments come before the audio or image data, but
+// embedded cover art can push text frames back.
+const metadataWindow = 1 << 20
+
+// EXIF tags used for the sample.
+const (
+	exifDescription      = 0x010e
+	exifMake             = 0x010f
+	exifModel            = 0x0110
+	exifDateTime         = 0x0132
+	exifArtist           = 0x013b
+	exifIFDPointer       = 0x8769
+	exifDateTimeOriginal = 0x9003
+)
+
+// ParseContentSource validates a -content-source value.
+func ParseContentSource(value string) error {
+	switch value {
+	case ContentSourceContent, ContentSourceMetadata, ContentSourceAuto:
+		return nil
+	default:
+		return fmt.Errorf("unknown content source %q (want %s, %s or %s)", value, ContentSourceContent, ContentSourceMetadata, ContentSourceAuto)
+	}
+}
+
+// useMetadata reports whether opts asks for samples built from tags.
+func useMetadata(opts Options) bool {
+	return opts.ContentSource == ContentSourceMetadata || opts.ContentSource == ContentSourceAuto
+}
+
+// metadataField is one labeled value of a metadata sample.
+type metadataField struct {
+	label, value string
+}
+
+// MetadataSample builds a sample from the tags embedded in the file at path:
+// title, artist, album and year from the ID3 tags of an MP3, or camera,
+// date, description and artist from the EXIF data of a JPEG or TIFF image.
+// ok is false when the file has none of them.
+func MetadataSample(path string) (sample string, ok bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false, fmt.Errorf("open file: %w", err)
+	}
+	defer f.Close()
+	head, err := io.ReadAll(io.LimitReader(f, metadataWindow))
+	if err != nil {
+		return "", false, fmt.Errorf("read file: %w", err)
+	}
+
+	var title string
+	var fields []metadataField
+	audio := false
+	switch {
+	case bytes.HasPrefix(head, []byte{0xff, 0xd8}):
+		title, fields = "Photo EXIF tags", exifFields(jpegExif(head))
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		title, fields = "Photo EXIF tags", exifFields(head)
+	case bytes.HasPrefix(head, []byte("ID3")):
+		title, fields, audio = "Audio tags", id3v2Fields(head), true
+	case len(head) > 1 && head[0] == 0xff && head[1]&0xe0 == 0xe0:
+		// An MPEG audio frame with no ID3v2 tag in front.
+		title, audio = "Audio tags", true
+	}
+	if len(fields) == 0 && audio {
+		// ID3v1 tags sit in the last 128 bytes, also behind ID3v2 ones.
+		fields = id3v1Fields(f)
+	}
+	if len(fields) == 0 {
+		return "", false, nil
+	}
+
+	var b strings.Builder
+	b.WriteString(title + ":\n")
+	for _, field := range fields {
+		fmt.Fprintf(&b, "%s: %s\n", field.label, field.value)
+	}
+	return b.String(), true, nil
+}
+
+// FilterMetadata drops files without tags when opts.ContentSource is
+// ContentSourceMetadata. Files that cannot be read are kept so the usual
+// error is reported when they are named.
+func FilterMetadata(files []string, opts Options) ([]string, []SkippedFile) {
+	if opts.ContentSource != ContentSourceMetadata {
+		return files, nil
+	}
+	kept := make([]string, 0, len(files))
+	var skipped []SkippedFile
+	for _, path := range files {
+		if _, ok, err := MetadataSample(path); err == nil && !ok {
+			skipped = append(skipped, SkippedFile{path, "no metadata"})
+			continue
+		}
+		kept = append(kept, path)
+	}
+	return kept, skipped
+}
+
+// id3v2Fields reads the text frames of an ID3v2.3 or v2.4 tag at the start
+// of data.
+func id3v2Fields(data []byte) []metadataField {
+	if len(data) < 10 || (data[3] != 3 && data[3] != 4) {
+		return nil
+	}
+	version, flags := data[3], data[5]
+	end := min(len(data), 10+synchsafe(data[6:10]))
+	pos := 10
+	if flags&0x40 != 0 && pos+4 <= end {
+		// The extended header's size counts itself only in v2.4.
+		if version == 4 {
+			pos += synchsafe(data[pos : pos+4])
+		} else {
+			// Sizes are checked as uint64 so huge ones cannot wrap an int.
+			size := 4 + uint64(binary.BigEndian.Uint32(data[pos:pos+4]))
+			if size > uint64(end-pos) {
+				return nil
+			}
+			pos += int(size)
+		}
+	}
+
+	frames := map[string]string{}
+	for pos+10 <= end && data[pos] != 0 {
+		id := string(data[pos : pos+4])
+		size := uint64(binary.BigEndian.Uint32(data[pos+4 : pos+8]))
+		if version == 4 {
+			size = uint64(synchsafe(data[pos+4 : pos+8]))
+		}
+		pos += 10
+		if size > uint64(end-pos) {
+			break
+		}
+		if _, seen := frames[id]; !seen && strings.HasPrefix(id, "T") {
+			frames[id] = id3Text(data[pos : pos+int(size)])
+		}
+		pos += int(size)
+	}
+
+	var fields []metadataField
+	for _, frame := range []struct{ label, id string }{
+		{"title", "TIT2"}, {"artist", "TPE1"}, {"album", "TALB"}, {"year", "TDRC"}, {"year", "TYER"},
+	} {
+		if value := frames[frame.id]; value != "" && (len(fields) == 0 || fields[len(fields)-1].label != frame.label) {
+			fields = append(fields, metadataField{frame.label, value})
+		}
+	}
+	return fields
+}
+
+// synchsafe decodes an ID3v2 size stored in 7 bits per byte.
+func synchsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// id3Text decodes the first value of an ID3v2 text frame from the encoding
+// named by its first byte.
+func id3Text(frame []byte) string {
+	if len(frame) == 0 {
+		return ""
+	}
+	text := frame[1:]
+	switch frame[0] {
+	case 0:
+		text = DecodeSample(text, EncodingLatin1)
+	case 1:
+		encoding := EncodingUTF16LE
+		if bytes.HasPrefix(text, []byte{0xfe, 0xff}) {
+			encoding = EncodingUTF16BE
+		}
+		text = DecodeSample(text, encoding)
+	case 2:
+		text = DecodeSample(text, EncodingUTF16BE)
+	}
+	value, _, _ := strings.Cut(string(text), "\x00")
+	return cleanTag(value)
+}
+
+// id3v1Fields reads the ID3v1 tag at the end of f.
+func id3v1Fields(f *os.File) []metadataField {
+	info, err := f.Stat()
+	if err != nil || info.Size() < 128 {
+		return nil
+	}
+	tag := make([]byte, 128)
+	if _, err := f.ReadAt(tag, info.Size()-128); err != nil || !bytes.HasPrefix(tag, []byte("TAG")) {
+		return nil
+	}
+	var fields []metadataField
+	for _, field := range []struct {
+		label      string
+		start, end int
+	}{{"title", 3, 33}, {"artist", 33, 63}, {"album", 63, 93}, {"year", 93, 97}} {
+		if value := cleanTag(string(DecodeSample(tag[field.start:field.end], EncodingLatin1))); value != "" {
+			fields = append(fields, metadataField{field.label, value})
+		}
+	}
+	return fields
+}
+
+// jpegExif returns the TIFF data of the EXIF segment of a JPEG image, or nil
+// when there is none before the image data.
+func jpegExif(data []byte) []byte {
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xff {
+			return nil
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xff:
+			// Fill byte before a marker.
+			pos++
+			continue
+		case marker == 0xda || marker == 0xd9:
+			return nil
+		}
+		size := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		if size < 2 || pos+2+size > len(data) {
+			return nil
+		}
+		segment := data[pos+4 : pos+2+size]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		pos += 2 + size
+	}
+	return nil
+}
+
+// exifFields reads the camera, date, description and artist from TIFF data,
+// as found in a TIFF file or a JPEG EXIF segment.
+func exifFields(tiff []byte) []metadataField {
+	if len(tiff) < 8 {
+		return nil
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+	values := map[uint16]string{}
+	if exif := readIFD(tiff, order, order.Uint32(tiff[4:8]), values); exif != 0 {
+		readIFD(tiff, order, exif, values)
+	}
+
+	var fields []metadataField
+	camera, maker := values[exifModel], values[exifMake]
+	if brand := strings.Fields(maker); len(brand) > 0 && !strings.HasPrefix(strings.ToLower(camera), strings.ToLower(brand[0])) {
+		// Models usually repeat the make, as in "Canon EOS R5".
+		camera = strings.TrimSpace(maker + " " + camera)
+	}
+	taken := values[exifDateTimeOriginal]
+	if taken == "" {
+		taken = values[exifDateTime]
+	}
+	for _, field := range []metadataField{
+		{"camera", camera}, {"taken", taken}, {"description", values[exifDescription]}, {"artist", values[exifArtist]},
+	} {
+		if field.value != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// readIFD stores the ASCII values of the image file directory at offset in
+// values and returns the offset of the EXIF directory it points to, or 0.
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32, values map[uint16]string) uint32 {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return 0
+	}
+	var exif uint32
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		start := uint64(offset) + 2 + uint64(i)*12
+		if start+12 > uint64(len(tiff)) {
+			break
+		}
+		entry := tiff[start : start+12]
+		tag, kind, n := order.Uint16(entry), order.Uint16(entry[2:]), uint64(order.Uint32(entry[4:]))
+		switch {
+		case tag == exifIFDPointer && kind == 4:
+			exif = order.Uint32(entry[8:])
+		case kind == 2 && n <= 4:
+			values[tag] = cleanTag(string(entry[8 : 8+n]))
+		case kind == 2:
+			at := uint64(order.Uint32(entry[8:]))
+			if at+n <= uint64(len(tiff)) {
+				values[tag] = cleanTag(string(tiff[at : at+n]))
+			}
+		}
+	}
+	return exif
+}
+
+// cleanTag turns a tag value into one line of valid UTF-8 without NULs or
+// padding.
+func cleanTag(value string) string {
+	value = strings.ToValidUTF8(strings.ReplaceAll(value, "\x00", ""), "\uFFFD")
+	return strings.Join(strings.Fields(value), " ")
+}
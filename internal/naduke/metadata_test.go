@@ -0,0 +1,223 @@
+package naduke
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// id3Frame builds an ID3v2.3 text frame; v2.4 sizes are synchsafe, which is
+// the same for frames under 128 bytes.
+func id3Frame(id string, encoding byte, text []byte) []byte {
+	frame := []byte(id)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(text)+1))
+	frame = append(frame, 0, 0, encoding)
+	return append(frame, text...)
+}
+
+// id3Tag wraps frames in an ID3v2 header of version, followed by padding and
+// a fake MPEG frame.
+func id3Tag(version byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	body = append(body, make([]byte, 16)...)
+	size := len(body)
+	tag := []byte{'I', 'D', '3', version, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(append(tag, body...), 0xff, 0xfb, 0x90, 0x00)
+}
+
+// id3v1Tag builds a 128-byte ID3v1 tag.
+func id3v1Tag(title, artist, album, year string) []byte {
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	copy(tag[3:33], title)
+	copy(tag[33:63], artist)
+	copy(tag[63:93], album)
+	copy(tag[93:97], year)
+	return tag
+}
+
+// exifJPEG builds a JPEG start with an EXIF segment holding ASCII tags in
+// IFD0 and DateTimeOriginal in the EXIF IFD.
+func exifJPEG(order binary.AppendByteOrder, ifd0 map[uint16]string, original string) []byte {
+	tiff := []byte("II*\x00")
+	if order == binary.BigEndian {
+		tiff = []byte("MM\x00*")
+	}
+	tiff = order.AppendUint32(tiff, 8)
+
+	ifd := func(start int, tags []uint16, values map[uint16]string, pointer uint32) []byte {
+		count := len(tags)
+		if pointer != 0 {
+			count++
+		}
+		data := start + 2 + count*12 + 4
+		var entries, extra []byte
+		entries = order.AppendUint16(entries, uint16(count))
+		for _, tag := range tags {
+			value := append([]byte(values[tag]), 0)
+			entries = order.AppendUint16(entries, tag)
+			entries = order.AppendUint16(entries, 2)
+			entries = order.AppendUint32(entries, uint32(len(value)))
+			if len(value) <= 4 {
+				entries = append(entries, append(value, make([]byte, 4-len(value))...)...)
+				continue
+			}
+			entries = order.AppendUint32(entries, uint32(data+len(extra)))
+			extra = append(extra, value...)
+		}
+		if pointer != 0 {
+			entries = order.AppendUint16(entries, exifIFDPointer)
+			entries = order.AppendUint16(entries, 4)
+			entries = order.AppendUint32(entries, 1)
+			entries = order.AppendUint32(entries, pointer)
+		}
+		entries = order.AppendUint32(entries, 0)
+		return append(entries, extra...)
+	}
+
+	var tags []uint16
+	for _, tag := range []uint16{exifDescription, exifMake, exifModel, exifDateTime, exifArtist} {
+		if _, ok := ifd0[tag]; ok {
+			tags = append(tags, tag)
+		}
+	}
+	// Lay out IFD0 once to learn where the EXIF IFD goes after it.
+	first := ifd(8, tags, ifd0, 1)
+	tiff = append(tiff, ifd(8, tags, ifd0, uint32(8+len(first)))...)
+	tiff = append(tiff, ifd(len(tiff), []uint16{exifDateTimeOriginal}, map[uint16]string{exifDateTimeOriginal: original}, 0)...)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	jpeg := []byte{0xff, 0xd8, 0xff, 0xe1}
+	jpeg = binary.BigEndian.AppendUint16(jpeg, uint16(len(segment)+2))
+	jpeg = append(jpeg, segment...)
+	return append(jpeg, 0xff, 0xda, 0x00, 0x02, 0xde, 0xad)
+}
+
+func TestMetadataSample(t *testing.T) {
+	t.Parallel()
+
+	utf16Title := []byte{0xff, 0xfe}
+	for _, r := range "Café Song" {
+		utf16Title = binary.LittleEndian.AppendUint16(utf16Title, uint16(r))
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+		ok   bool
+	}{
+		{
+			"id3v2.3",
+			id3Tag(3, id3Frame("TIT2", 1, utf16Title), id3Frame("TPE1", 0, []byte("The Band")), id3Frame("TALB", 3, []byte("Live\x00Bonus")), id3Frame("TYER", 0, []byte("1999"))),
+			"Audio tags:\ntitle: Café Song\nartist: The Band\nalbum: Live\nyear: 1999\n",
+			true,
+		},
+		{
+			"id3v2.4",
+			id3Tag(4, id3Frame("TDRC", 3, []byte("2024-05-01")), id3Frame("TIT2", 3, []byte("Morning Walk"))),
+			"Audio tags:\ntitle: Morning Walk\nyear: 2024-05-01\n",
+			true,
+		},
+		{
+			"id3v1",
+			append([]byte{0xff, 0xfb, 0x90, 0x00, 1, 2, 3}, id3v1Tag("Old Tune", "Someone", "", "1987")...),
+			"Audio tags:\ntitle: Old Tune\nartist: Someone\nyear: 1987\n",
+			true,
+		},
+		{
+			"exif big endian",
+			exifJPEG(binary.BigEndian, map[uint16]string{exifMake: "Canon", exifModel: "Canon EOS R5", exifDateTime: "2024:06:02 08:00:00"}, "2024:06:01 17:30:00"),
+			"Photo EXIF tags:\ncamera: Canon EOS R5\ntaken: 2024:06:01 17:30:00\n",
+			true,
+		},
+		{
+			"exif little endian",
+			exifJPEG(binary.LittleEndian, map[uint16]string{exifMake: "NIKON CORPORATION", exifModel: "D750", exifDescription: "Harbor at dusk", exifArtist: "Ann"}, ""),
+			"Photo EXIF tags:\ncamera: NIKON CORPORATION D750\ndescription: Harbor at dusk\nartist: Ann\n",
+			true,
+		},
+		{
+			"id3v2.3 huge frame size",
+			id3Tag(3, id3Frame("TIT2", 0, []byte("Kept")), append([]byte("TPE1\xff\xff\xff\xff\x00\x00"), "Artist"...)),
+			"Audio tags:\ntitle: Kept\n",
+			true,
+		},
+		{
+			"id3v2.3 huge extended header",
+			func() []byte {
+				tag := id3Tag(3, []byte{0xff, 0xff, 0xff, 0xff, 0, 0}, id3Frame("TIT2", 0, []byte("Lost")))
+				tag[5] = 0x40
+				return tag
+			}(),
+			"",
+			false,
+		},
+		{"jpeg without exif", []byte{0xff, 0xd8, 0xff, 0xda, 0x00, 0x02, 0x00}, "", false},
+		{"text", []byte("TAG line in a text file"), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "media")
+			if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+				t.Fatalf("write fixture: %v", err)
+			}
+			got, ok, err := MetadataSample(path)
+			if err != nil {
+				t.Fatalf("MetadataSample error: %v", err)
+			}
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("MetadataSample = %q, %v; want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestReadSampleContentSource(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	song := filepath.Join(dir, "track01.mp3")
+	if err := os.WriteFile(song, id3Tag(3, id3Frame("TIT2", 0, []byte("Night Drive"))), 0o644); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+	note := filepath.Join(dir, "note.txt")
+	if err := os.WriteFile(note, []byte("meeting notes"), 0o644); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+
+	tests := []struct {
+		source, path, want string
+	}{
+		{ContentSourceMetadata, song, "Audio tags:\ntitle: Night Drive\n"},
+		{ContentSourceMetadata, note, ""},
+		{ContentSourceAuto, song, "Audio tags:\ntitle: Night Drive\n"},
+		{ContentSourceAuto, note, "meeting notes"},
+		{ContentSourceContent, note, "meeting notes"},
+	}
+	for _, tt := range tests {
+		got, err := ReadSample(tt.path, Options{ContentSource: tt.source})
+		if err != nil {
+			t.Fatalf("ReadSample(%s, %s) error: %v", tt.path, tt.source, err)
+		}
+		if got != tt.want {
+			t.Fatalf("ReadSample(%s, %s) = %q; want %q", tt.path, tt.source, got, tt.want)
+		}
+	}
+
+	kept, skipped := FilterMetadata([]string{note, song}, Options{ContentSource: ContentSourceMetadata})
+	if len(kept) != 1 || kept[0] != song || len(skipped) != 1 || skipped[0] != (SkippedFile{note, "no metadata"}) {
+		t.Fatalf("FilterMetadata = %v, %v", kept, skipped)
+	}
+	if kept, skipped := FilterMetadata([]string{note, song}, Options{ContentSource: ContentSourceAuto}); len(kept) != 2 || skipped != nil {
+		t.Fatalf("auto should skip nothing: %v, %v", kept, skipped)
+	}
+
+	if err := ParseContentSource("exif"); err == nil {
+		t.Fatalf("expected an unknown content source to be rejected")
+	}
+}
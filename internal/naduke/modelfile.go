@@ -0,0 +1,98 @@
+package naduke
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// modelParameters maps the sampling parameters naduke understands to the
+// Options field they set.
+var modelParameters = map[string]func(opts *Options, value string) error{
+	"temperature":    floatParam(func(o *Options) *float64 { return &o.Temperature }),
+	"top_k":          intParam(func(o *Options) *int { return &o.TopK }),
+	"top_p":          floatParam(func(o *Options) *float64 { return &o.TopP }),
+	"repeat_penalty": floatParam(func(o *Options) *float64 { return &o.RepeatPenalty }),
+	"min_p":          floatParam(func(o *Options) *float64 { return &o.MinP }),
+	"mirostat":       intParam(func(o *Options) *int { return &o.Mirostat }),
+	"mirostat_eta":   floatParam(func(o *Options) *float64 { return &o.MirostatEta }),
+	"mirostat_tau":   floatParam(func(o *Options) *float64 { return &o.MirostatTau }),
+}
+
+func floatParam(field func(*Options) *float64) func(*Options, string) error {
+	return func(opts *Options, value string) error {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*field(opts) = v
+		return nil
+	}
+}
+
+func intParam(field func(*Options) *int) func(*Options, string) error {
+	return func(opts *Options, value string) error {
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(opts) = v
+		return nil
+	}
+}
+
+// ParseModelfile reads sampling parameters from an Ollama Modelfile
+// ("PARAMETER temperature 0.7") or a simple "key = value" file. Only the
+// parameters naduke understands are returned; other instructions, unknown
+// parameters and triple-quoted TEMPLATE/SYSTEM blocks are skipped.
+func ParseModelfile(r io.Reader) (map[string]string, error) {
+	params := map[string]string{}
+	inBlock := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.Count(line, `"""`)%2 == 1 {
+			inBlock = !inBlock
+			continue
+		}
+		if inBlock || line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var key, value string
+		fields := strings.Fields(line)
+		switch {
+		case strings.EqualFold(fields[0], "PARAMETER") && len(fields) >= 3:
+			key, value = fields[1], strings.Join(fields[2:], " ")
+		case strings.Contains(line, "="):
+			key, value, _ = strings.Cut(line, "=")
+		default:
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		if _, ok := modelParameters[key]; ok {
+			params[key] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read modelfile: %w", err)
+	}
+	return params, nil
+}
+
+// ApplyModelParameters sets the Options fields for params, skipping any
+// parameter for which keep reports true (for example because its flag was
+// given explicitly).
+func ApplyModelParameters(opts *Options, params map[string]string, keep func(param string) bool) error {
+	for key, value := range params {
+		if keep != nil && keep(key) {
+			continue
+		}
+		if err := modelParameters[key](opts, value); err != nil {
+			return fmt.Errorf("modelfile parameter %s: %w", key, err)
+		}
+	}
+	return nil
+}
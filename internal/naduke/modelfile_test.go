@@ -0,0 +1,58 @@
+package naduke
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseModelfile(t *testing.T) {
+	t.Parallel()
+
+	modelfile := `
+FROM granite4:3b-h
+# house defaults
+PARAMETER temperature 0.7
+PARAMETER top_k 40
+PARAMETER stop "<|end|>"
+PARAMETER num_ctx 8192
+TEMPLATE """
+temperature = 9
+"""
+SYSTEM You name things.
+top_p = 0.9
+`
+	params, err := ParseModelfile(strings.NewReader(modelfile))
+	if err != nil {
+		t.Fatalf("ParseModelfile error: %v", err)
+	}
+	want := map[string]string{"temperature": "0.7", "top_k": "40", "top_p": "0.9"}
+	if len(params) != len(want) {
+		t.Fatalf("unexpected params: %v", params)
+	}
+	for k, v := range want {
+		if params[k] != v {
+			t.Fatalf("%s = %q; want %q", k, params[k], v)
+		}
+	}
+}
+
+func TestApplyModelParameters(t *testing.T) {
+	t.Parallel()
+
+	opts := Options{Temperature: 0, TopK: 1, TopP: 1}
+	params := map[string]string{"temperature": "0.7", "top_k": "40", "mirostat": "2"}
+	explicit := map[string]bool{"top_k": true}
+	if err := ApplyModelParameters(&opts, params, func(p string) bool { return explicit[p] }); err != nil {
+		t.Fatalf("ApplyModelParameters error: %v", err)
+	}
+	if opts.Temperature != 0.7 || opts.Mirostat != 2 {
+		t.Fatalf("modelfile values not applied: %+v", opts)
+	}
+	if opts.TopK != 1 {
+		t.Fatalf("explicit top_k should win, got %d", opts.TopK)
+	}
+
+	if err := ApplyModelParameters(&opts, map[string]string{"top_k": "many"}, nil); err == nil {
+		t.Fatalf("expected error for non-numeric top_k")
+	}
+}
@@ -2,16 +2,26 @@ package naduke
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -25,7 +35,30 @@ const (
 	DefaultRepeatPenalty = 1.0
 	DefaultPrefix        = ""
 	DefaultDir           = ""
+	DefaultRetries       = 0
+	DefaultTempStep      = 0.3
+	DefaultMaxTemp       = 1.0
+	DefaultHTTPRetries   = 3
+	DefaultEmptyRetries  = 2
+	DefaultJobs          = 1
+	DefaultPromptProfile = ProfileAuto
+	DefaultOnCollision   = CollisionError
+	DefaultOnAmbiguous   = AmbiguousKeep
+	DefaultOnModelError  = ErrorContinue
+	DefaultOnFSError     = ErrorAbort
+	DefaultHashLength    = 6
+	DefaultHashSource    = HashSourceFile
+	DefaultContentTag    = "content"
+	DefaultDatePattern   = `^(\d{4}-\d{2}-\d{2})(?:\D|$)`
+	DefaultKeepNumbers   = `^(19|20)\d{2}$`
+	DefaultBadNames      = `(?i)^(?:(?:untitled|new[ _-]?(?:text[ _-]?)?(?:document|file)|document|file|scan|img|dsc|dscn|image|photo|download)(?:[ _-]*\(?\d*\)?)?|\d+|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})$`
+	DefaultAllowedExts   = "txt,md,markdown,json,csv,tsv,xml,html,yaml,yml,toml,ini,log,sql,go,py,js,ts,sh,rb,java,c,h,cpp,rs"
 	readChars            = 1000
+	normalizeReadFactor  = 4
+	maxRetryAfter        = 2 * time.Minute
+	maxNameLength        = 30
+	dirContextDepth      = 2
+	emptyRetryDelay      = time.Second
 )
 
 var (
@@ -46,34 +79,229 @@ Generate an appropriate file name for this text file content.
 %s
 </content>
 `)
+	// extSystemPrompt replaces the extension rules of systemPrompt when the
+	// model may suggest an extension.
+	extSystemPrompt = strings.TrimSpace(`
+You are a tool that generates file names.
+You MUST follow these rules:
+- Output only a single file name.
+- You may end it with one file extension such as .json or .md when the
+  content clearly is of that type; otherwise add no extension.
+- Use only lowercase letters a-z, digits 0-9, and underscores before the extension.
+- No spaces, no hyphens, no other characters.
+- Less than or equal than 30 characters, not counting the extension.
+- Make it concise but descriptive of the text content.
+`)
+	refinePrompt = strings.TrimSpace(`
+Improve the existing file name for this text file content.
+The current name is authoritative: keep its meaning and any accurate words,
+and only correct, clarify, or complete it using the content.
+
+<current_name>
+%s
+</current_name>
+
+<content>
+%s
+</content>
+`)
+	// folderPrompt is placed before the content with -use-dir-context.
+	folderPrompt = `The file is stored in this folder, which may hint at what it is;
+name the file after its content and use the folder only to disambiguate.
+
+<folder>
+%s
+</folder>
+
+`
 	invalidChars = regexp.MustCompile(`[^a-z0-9_]`)
 	namePattern  = regexp.MustCompile(`^[a-z0-9_]{1,30}$`)
+	nameChars    = regexp.MustCompile(`^[a-z0-9_]+$`)
+	// pathAnswer matches answers that start like a URL (scheme://), a Windows
+	// drive (C:\), an absolute or home path, or a UNC share.
+	pathAnswer = regexp.MustCompile(`^(?:[A-Za-z][A-Za-z0-9+.-]*://|[A-Za-z]:[\\/]|~?/|\\\\)`)
+	// contentTagPattern limits -content-tag to plain tag names.
+	contentTagPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
 )
 
 type Options struct {
-	Host          string
-	Port          int
-	Server        string
-	Model         string
-	Temperature   float64
-	TopK          int
-	TopP          float64
-	RepeatPenalty float64
-	DryRun        bool
-	Prefix        string
-	Dir           string
+	Host           string
+	Port           int
+	Server         string
+	Socket         string
+	NoProxy        bool
+	Model          string
+	Temperature    float64
+	TopK           int
+	TopP           float64
+	RepeatPenalty  float64
+	MinP           float64
+	Mirostat       int
+	MirostatEta    float64
+	MirostatTau    float64
+	DryRun         bool
+	ApplyOnConfirm bool
+	Prefix         string
+	Dir            string
+	// TrimAtNewline cuts a truncated sample back to its last complete line.
+	TrimAtNewline           bool
+	TrimAtSentence          bool
+	BaseNameOnly            bool
+	ExtRewrites             map[string]string
+	ModelForExt             map[string]string
+	FallbackModels          []string
+	Link                    bool
+	AllowExt                bool
+	Recursive               bool
+	OnlyExts                map[string]bool
+	PreserveTree            bool
+	TreeRoots               []string
+	Jobs                    int
+	HostConcurrency         map[string]int
+	Batch                   int
+	BatchTokens             int
+	PromptProfile           string
+	Verbose                 bool
+	NormalizeWhitespace     bool
+	StripEmoji              bool
+	Prefilters              []*regexp.Regexp
+	HeadTailSplit           float64
+	Since                   time.Time
+	MinSize                 int64
+	MaxSize                 int64
+	EntropyThreshold        float64
+	ShowRaw                 bool
+	OnCollision             string
+	OnAmbiguous             string
+	OnModelError            string
+	OnFSError               string
+	RetryTimeout            time.Duration
+	RequestTimeout          time.Duration
+	MaxRequestTimeout       time.Duration
+	RepeatedNameLimit       int
+	PromptLanguageOfContent bool
+	FitContext              bool
+	UseDirContext           bool
+	HashLength              int
+	HashSource              string
+	PreserveDatePrefix      bool
+	DatePattern             *regexp.Regexp
+	Dedupe                  bool
+	DuplicateOf             map[string]string
+	LenientUTF8             bool
+	SampleEncoding          string
+	TrimNameFromContent     bool
+	ContentTag              string
+	Examples                []Example
+	NoExtensionStrip        bool
+	Sanitizer               Sanitizer
+	StripNumbers            bool
+	KeepNumbers             *regexp.Regexp
+	BadNames                *regexp.Regexp
+	EmptyRetries            int
+	ReadArchives            bool
+	Warmup                  bool
+	Validate                bool
+	ValidateName            string
+	KeepAlive               string
+	RequestID               bool
+	RequestIDHeader         string
+	RequestIDTemplate       string
+	JSON                    bool
+	JSONStream              bool
+	JSONPretty              bool
+	NameOnly                bool
+	Check                   bool
+	FlattenSeparators       string
+	MemoryCache             int
+	PrintURL                bool
+	OnEmpty                 string
+	EmptyName               string
+	HashAlgorithm           string
+	RequiredCapabilities    []string
+	UserAgent               string
+	StdinNameList           bool
+	RunTimeout              time.Duration
+	ContentSource           string
+	Sidecar                 bool
+	AllowedExts             []string
+	Symlink                 bool
+	PreserveOriginalXattr   bool
+	ExtraOptions            map[string]any
+	Retries                 int
+	RotatePrompts           bool
+	RetryPrompts            []string
+	TempStep                float64
+	MaxTemp                 float64
+	HTTPRetries             int
+	ConfirmAbove            int
+	Yes                     bool
 }
 
 type client struct {
 	http *http.Client
 	uri  *url.URL
+	// ctx cancels in-flight requests; nil means context.Background.
+	ctx context.Context
+	// version caches the probed server version; nil skips the probe.
+	version *versionCache
+	// backoff spaces out retries across workers; nil waits backoffBase.
+	backoff *backoff
+	// contexts caches the context length of each model for opts.FitContext;
+	// nil skips the probe.
+	contexts *contextCache
+	// suggestions remembers answers for opts.MemoryCache requests; nil
+	// asks the model every time.
+	suggestions *suggestionCache
+	// requestTimeout bounds each request to the server; zero means no
+	// limit besides ctx.
+	requestTimeout time.Duration
+	// retryDeadline ends the retries for the file being named; zero means
+	// no limit.
+	retryDeadline time.Time
+	// sleep and now are replaced in tests; nil means the real clock.
+	sleep func(time.Duration)
+	now   func() time.Time
+}
+
+// WithContext returns a copy of c whose requests are canceled with ctx.
+func (c *client) WithContext(ctx context.Context) *client {
+	copied := *c
+	copied.ctx = ctx
+	return &copied
+}
+
+// withRetryBudget returns a copy of c that stops retrying once
+// opts.RetryTimeout has passed, counted from now. A copy that already has a
+// deadline keeps it.
+func (c *client) withRetryBudget(opts Options) *client {
+	if opts.RetryTimeout <= 0 || !c.retryDeadline.IsZero() {
+		return c
+	}
+	copied := *c
+	copied.retryDeadline = c.clock().Add(opts.RetryTimeout)
+	return &copied
+}
+
+// canRetry reports whether a retry after waiting for wait still ends within
+// the retry budget.
+func (c *client) canRetry(wait time.Duration) bool {
+	return c.retryDeadline.IsZero() || !c.clock().Add(wait).After(c.retryDeadline)
+}
+
+func (c *client) context() context.Context {
+	if c.ctx != nil {
+		return c.ctx
+	}
+	return context.Background()
 }
 
 type chatRequest struct {
-	Model    string        `json:"model"`
-	Messages []chatMessage `json:"messages"`
-	Stream   bool          `json:"stream"`
-	Options  chatOptions   `json:"options"`
+	Model     string        `json:"model"`
+	Messages  []chatMessage `json:"messages"`
+	Stream    bool          `json:"stream"`
+	Options   chatOptions   `json:"options"`
+	KeepAlive string        `json:"keep_alive,omitempty"`
 }
 
 type chatOptions struct {
@@ -81,6 +309,34 @@ type chatOptions struct {
 	TopK          int     `json:"top_k"`
 	TopP          float64 `json:"top_p"`
 	RepeatPenalty float64 `json:"repeat_penalty"`
+	MinP          float64 `json:"min_p,omitempty"`
+	Mirostat      int     `json:"mirostat,omitempty"`
+	MirostatEta   float64 `json:"mirostat_eta,omitempty"`
+	MirostatTau   float64 `json:"mirostat_tau,omitempty"`
+	// Extra holds user-supplied options merged in underneath the typed fields.
+	Extra map[string]any `json:"-"`
+}
+
+// MarshalJSON encodes the typed sampling fields and fills in any Extra keys
+// they do not already cover, so typed flags always win.
+func (o chatOptions) MarshalJSON() ([]byte, error) {
+	type plain chatOptions
+	typed, err := json.Marshal(plain(o))
+	if err != nil || len(o.Extra) == 0 {
+		return typed, err
+	}
+	merged := make(map[string]any, len(o.Extra))
+	for k, v := range o.Extra {
+		merged[k] = v
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(typed, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return json.Marshal(merged)
 }
 
 type chatMessage struct {
@@ -94,18 +350,76 @@ type chatResponse struct {
 	Response string `json:"response"`
 }
 
-func NewClient(opts Options) (*client, error) {
+// NewClient returns a client for the server in opts, adjusted by options.
+func NewClient(opts Options, options ...ClientOption) (*client, error) {
 	uri, err := buildURI(opts)
 	if err != nil {
 		return nil, err
 	}
-	return &client{
-		http: &http.Client{},
-		uri:  uri,
-	}, nil
+	c := &client{
+		http:        &http.Client{Transport: newUserAgentTransport(newHostLimiter(newTransport(opts), opts), opts)},
+		uri:         uri,
+		version:     &versionCache{},
+		backoff:     &backoff{},
+		contexts:    &contextCache{},
+		suggestions: newSuggestionCache(opts.MemoryCache),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c, nil
+}
+
+// newTransport builds the HTTP transport for opts. It keeps honoring the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables unless
+// opts.NoProxy is set; socket connections never go through a proxy. Every
+// -jobs worker can keep its connection to the server idle between files
+// instead of reconnecting.
+func newTransport(opts Options) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = max(opts.Jobs, http.DefaultMaxIdleConnsPerHost)
+	transport.MaxIdleConns = max(opts.Jobs, transport.MaxIdleConns)
+	transport.Proxy = http.ProxyFromEnvironment
+	if opts.NoProxy {
+		transport.Proxy = nil
+	}
+	if opts.Socket != "" {
+		// Dial the Unix domain socket for every request, ignoring the URL host.
+		var dialer net.Dialer
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", opts.Socket)
+		}
+	}
+	return transport
+}
+
+// RequestURL returns the chat endpoint requests for opts go to, with any
+// password and query values redacted so it can be printed. A -socket
+// endpoint names the socket too, since its URL host is only a placeholder.
+func RequestURL(opts Options) (string, error) {
+	uri, err := buildURI(opts)
+	if err != nil {
+		return "", err
+	}
+	redacted := *uri
+	if query := redacted.Query(); len(query) > 0 {
+		for key := range query {
+			query[key] = []string{"xxxxx"}
+		}
+		redacted.RawQuery = query.Encode()
+	}
+	if opts.Socket != "" {
+		return redacted.Redacted() + " (via unix socket " + opts.Socket + ")", nil
+	}
+	return redacted.Redacted(), nil
 }
 
 func buildURI(opts Options) (*url.URL, error) {
+	if opts.Socket != "" {
+		// The host is a placeholder; the transport always dials the socket.
+		return &url.URL{Scheme: "http", Host: "unix", Path: "/api/chat"}, nil
+	}
 	if opts.Server != "" {
 		parsed, err := url.Parse(opts.Server)
 		if err != nil {
@@ -124,51 +438,141 @@ func buildURI(opts Options) (*url.URL, error) {
 	}, nil
 }
 
-func (c *client) GenerateName(model string, temperature float64, topK int, topP float64, repeatPenalty float64, content string) (string, error) {
+// GenerateName asks the models from ModelsFor, in order, for a file name
+// describing content read from path, using the sampling parameters from opts.
+// An empty answer is asked again up to opts.EmptyRetries times after a short
+// delay. No retry starts once opts.RetryTimeout has passed.
+func (c *client) GenerateName(opts Options, path, content string) (string, error) {
+	return c.withRetryBudget(opts).generate(opts, path, content, "", nil)
+}
+
+// generate is GenerateName with the opening line of the user prompt replaced
+// by instruction, unless it is empty, and follow-up messages appended after
+// the user prompt, such as a rejected answer and the correction asked for.
+func (c *client) generate(opts Options, path, content, instruction string, followUp []chatMessage) (string, error) {
+	c = c.withRequestTimeout(opts, fileSize(path))
+	profile := ResolveProfile(opts.PromptProfile, path, content)
+	models := ModelsFor(opts, path)
+	slog.Debug("prompt profile", "path", path, "profile", profile, "model", models[0])
+
+	system := systemMessage(opts, profile)
+	if opts.PromptLanguageOfContent && profile != ProfileCode {
+		if line := languageMessage(content); line != "" {
+			slog.Debug("content language", "path", path, "guidance", line)
+			system += "\n" + line
+		}
+	}
+	messages := []chatMessage{{Role: "system", Content: system}}
+	messages = append(messages, exampleMessages(opts)...)
+	if opts.FitContext {
+		others := append(append(slices.Clip(messages), chatMessage{Content: instructedMessage(opts, path, "", instruction)}), followUp...)
+		content = c.fitContext(opts, path, models, others, content)
+	}
+	messages = append(messages, chatMessage{Role: "user", Content: instructedMessage(opts, path, content, instruction)})
+	messages = append(messages, followUp...)
+
+	key, cacheable := suggestionKey(opts, models, messages)
+	if name, ok := c.suggestions.get(key); ok && cacheable {
+		slog.Debug("suggestion cache hit", "path", path)
+		return name, nil
+	}
+	name, err := c.complete(opts, path, models, messages)
+	if err != nil {
+		return "", err
+	}
+	if cacheable {
+		c.suggestions.add(key, name)
+	}
+	return name, nil
+}
+
+// complete sends messages to each of models in turn with the sampling
+// parameters from opts and returns the first answer. path is only used in
+// logs and the request id.
+func (c *client) complete(opts Options, path string, models []string, messages []chatMessage) (string, error) {
 	reqBody := chatRequest{
-		Model: model,
-		Messages: []chatMessage{
-			{Role: "system", Content: systemPrompt},
-			{Role: "user", Content: fmt.Sprintf(userPrompt, content)},
-		},
-		Stream: false,
-		Options: chatOptions{
-			Temperature:   temperature,
-			TopK:          topK,
-			TopP:          topP,
-			RepeatPenalty: repeatPenalty,
-		},
+		Messages:  messages,
+		Stream:    false,
+		KeepAlive: opts.KeepAlive,
+		Options:   c.dropUnsupported(samplingOptions(opts)),
+	}
+
+	var errs []error
+	for _, model := range models {
+		reqBody.Model = model
+		name, err := c.generateWith(opts, path, reqBody)
+		if err == nil {
+			return name, nil
+		}
+		if len(models) == 1 || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return "", err
+		}
+		slog.Debug("model failed, trying next", "path", path, "model", model, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", model, err))
+	}
+	return "", fmt.Errorf("all models failed: %w", errors.Join(errs...))
+}
+
+// samplingOptions returns the request options set by opts.
+func samplingOptions(opts Options) chatOptions {
+	return chatOptions{
+		Temperature:   opts.Temperature,
+		TopK:          opts.TopK,
+		TopP:          opts.TopP,
+		RepeatPenalty: opts.RepeatPenalty,
+		MinP:          opts.MinP,
+		Mirostat:      opts.Mirostat,
+		MirostatEta:   opts.MirostatEta,
+		MirostatTau:   opts.MirostatTau,
+		Extra:         opts.ExtraOptions,
 	}
+}
 
+// generateWith sends reqBody to its model, retrying empty answers up to
+// opts.EmptyRetries times.
+func (c *client) generateWith(opts Options, path string, reqBody chatRequest) (string, error) {
 	payload, err := json.Marshal(reqBody)
 	if err != nil {
 		return "", fmt.Errorf("marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, c.uri.String(), bytes.NewReader(payload))
-	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
+	header := requestHeader(opts, path)
+	for name, values := range header {
+		slog.Debug("request id", "path", path, "model", reqBody.Model, "header", name, "value", values[0])
 	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.http.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("request model: %w", err)
+	for attempt := 0; ; attempt++ {
+		name, err := c.chat(opts, reqBody.Model, payload, header)
+		if !errors.Is(err, ErrModelEmptyResponse) || attempt >= opts.EmptyRetries {
+			return name, err
+		}
+		if !c.canRetry(emptyRetryDelay) {
+			slog.Debug("retry timeout reached", "path", path)
+			return name, err
+		}
+		// Empty answers are often a model still warming up.
+		slog.Debug("empty response, retrying", "path", path, "attempt", attempt+1)
+		if err := c.wait(emptyRetryDelay); err != nil {
+			return "", err
+		}
 	}
-	defer resp.Body.Close()
+}
 
-	body, err := io.ReadAll(resp.Body)
+func (c *client) chat(opts Options, model string, payload []byte, header http.Header) (string, error) {
+	status, body, err := c.post(opts, payload, header)
 	if err != nil {
-		return "", fmt.Errorf("read response: %w", err)
+		return "", err
 	}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("model request failed (%d): %s", resp.StatusCode, string(body))
+	if status == http.StatusNotFound && bytes.Contains(body, []byte("not found")) {
+		return "", c.modelNotFound(model)
+	}
+	if status < 200 || status >= 300 {
+		return "", &ModelRequestError{StatusCode: status, Body: string(body)}
 	}
 
 	var decoded chatResponse
 	if err := json.Unmarshal(body, &decoded); err != nil {
-		return "", fmt.Errorf("parse response: %w", err)
+		return "", fmt.Errorf("%w: parse response: %v", ErrModelRequestFailed, err)
 	}
 
 	switch {
@@ -177,21 +581,489 @@ func (c *client) GenerateName(model string, temperature float64, topK int, topP
 	case decoded.Response != "":
 		return decoded.Response, nil
 	default:
-		return "", errors.New("empty response from model")
+		return "", ErrModelEmptyResponse
+	}
+}
+
+// Warmup loads every model the run may use, opts.Model and those from
+// opts.ModelForExt, by sending each a chat request without messages, so the
+// first files do not pay the load time.
+func (c *client) Warmup(opts Options) error {
+	models := []string{opts.Model}
+	for _, model := range opts.ModelForExt {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for i, model := range models {
+		if i > 0 && model == models[i-1] {
+			continue
+		}
+		payload, err := json.Marshal(chatRequest{Model: model, Messages: []chatMessage{}, KeepAlive: opts.KeepAlive})
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+		slog.Debug("warm up model", "model", model)
+		status, body, err := c.post(opts, payload, nil)
+		if err != nil {
+			return err
+		}
+		if status == http.StatusNotFound && bytes.Contains(body, []byte("not found")) {
+			return c.modelNotFound(model)
+		}
+		if status < 200 || status >= 300 {
+			return &ModelRequestError{StatusCode: status, Body: string(body)}
+		}
+	}
+	return nil
+}
+
+// ModelFor returns the model mapped to path's extension in opts.ModelForExt,
+// falling back to opts.Model.
+func ModelFor(opts Options, path string) string {
+	if model, ok := opts.ModelForExt[NormalizeExt(filepath.Ext(path))]; ok {
+		return model
+	}
+	return opts.Model
+}
+
+// ModelsFor returns the models to try for path in order: ModelFor first, then
+// opts.FallbackModels, without repeats.
+func ModelsFor(opts Options, path string) []string {
+	models := []string{ModelFor(opts, path)}
+	for _, model := range opts.FallbackModels {
+		if !slices.Contains(models, model) {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// post sends payload to the chat endpoint and returns the status code and
+// body. A 429 Too Many Requests, or a 502, 503 or 504 from a server that is
+// briefly unavailable, is retried up to opts.HTTPRetries times after waiting
+// as long as the server's Retry-After header asks, or for a jittered backoff
+// shared with the other workers when it does not say. Every attempt carries
+// header, such as the -request-id correlation header. Each attempt that
+// outlives the client's request timeout fails as a model request, so the
+// next fallback model is still tried.
+func (c *client) post(opts Options, payload []byte, header http.Header) (int, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := c.requestContext()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.uri.String(), bytes.NewReader(payload))
+		if err != nil {
+			cancel()
+			return 0, nil, fmt.Errorf("create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for name, values := range header {
+			req.Header[name] = values
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			cancel()
+			return 0, nil, c.timedOut(ctx, fmt.Errorf("request model: %w", err))
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		cancel()
+		if err != nil {
+			return 0, nil, c.timedOut(ctx, fmt.Errorf("%w: read response: %w", ErrModelRequestFailed, err))
+		}
+
+		if !retryableStatus(resp.StatusCode) || attempt >= opts.HTTPRetries {
+			if !retryableStatus(resp.StatusCode) {
+				c.backoff.reset()
+			}
+			return resp.StatusCode, body, nil
+		}
+		wait, ok := retryAfter(resp.Header.Get("Retry-After"), c.clock())
+		if !ok {
+			wait = c.backoff.next()
+		}
+		if !c.canRetry(wait) {
+			slog.Debug("retry timeout reached", "status", resp.StatusCode, "attempt", attempt+1)
+			return resp.StatusCode, body, nil
+		}
+		slog.Debug("retrying request", "status", resp.StatusCode, "attempt", attempt+1, "wait", wait)
+		if err := c.wait(wait); err != nil {
+			return 0, nil, fmt.Errorf("request model: %w", err)
+		}
+	}
+}
+
+// retryableStatus reports whether a response with status is worth retrying.
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header given either as seconds or as an
+// HTTP date, capped at maxRetryAfter. It reports false without a usable
+// value.
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	var wait time.Duration
+	if secs, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && secs >= 0 {
+		wait = time.Duration(secs) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		wait = max(at.Sub(now), 0)
+	} else {
+		return 0, false
+	}
+	return min(wait, maxRetryAfter), true
+}
+
+// wait pauses for d, or until the client's context is canceled, whose error
+// it then returns.
+func (c *client) wait(d time.Duration) error {
+	ctx := c.context()
+	if c.sleep != nil {
+		c.sleep(d)
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *client) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// systemMessage picks the system prompt for opts and swaps in the naming
+// guidance for the file's prompt profile.
+func systemMessage(opts Options, profile string) string {
+	prompt := systemPrompt
+	if opts.AllowExt {
+		prompt = extSystemPrompt
+	}
+	if profile == ProfileCode {
+		prompt = strings.Replace(prompt, proseGuidance, codeGuidance, 1)
+	}
+	return prompt
+}
+
+// userMessage renders the user prompt for the file at path. With
+// opts.BaseNameOnly the current base name is included so the model refines it
+// instead of inventing a new one. With opts.UseDirContext the names of the
+// folders holding the file come before the content as a hint.
+func userMessage(opts Options, path, content string) string {
+	return instructedMessage(opts, path, content, "")
+}
+
+// instructedMessage is userMessage with its opening line replaced by
+// instruction, unless it is empty.
+func instructedMessage(opts Options, path, content, instruction string) string {
+	tag := opts.ContentTag
+	if tag == "" {
+		tag = DefaultContentTag
+	}
+	tags := []string{tag, "current_name", "folder"}
+	content = NeutralizeDelimiters(content, tags...)
+
+	prompt := userPrompt
+	if opts.BaseNameOnly {
+		prompt = refinePrompt
+	}
+	if instruction != "" {
+		_, rest, _ := strings.Cut(prompt, "\n")
+		prompt = strings.ReplaceAll(instruction, "%", "%%") + "\n" + rest
+	}
+	prompt = strings.NewReplacer("<content>", "<"+tag+">", "</content>", "</"+tag+">").Replace(prompt)
+	if dir := DirContext(path); opts.UseDirContext && dir != "" {
+		folder := fmt.Sprintf(folderPrompt, NeutralizeDelimiters(dir, tags...))
+		prompt = strings.Replace(prompt, "<"+tag+">", strings.ReplaceAll(folder, "%", "%%")+"<"+tag+">", 1)
+	}
+	if opts.BaseNameOnly {
+		base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		return fmt.Sprintf(prompt, NeutralizeDelimiters(base, tags...), content)
+	}
+	return fmt.Sprintf(prompt, content)
+}
+
+// DirContext returns the names of the last dirContextDepth folders holding
+// path, joined with "/", such as "invoices/2024" for
+// "/home/me/invoices/2024/scan.txt". It is empty for a file at the root or an
+// example without a path.
+func DirContext(path string) string {
+	if path == "" {
+		return ""
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return ""
+	}
+	var names []string
+	for _, name := range strings.Split(filepath.ToSlash(dir), "/") {
+		if name != "" && !strings.HasSuffix(name, ":") {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names[max(0, len(names)-dirContextDepth):], "/")
+}
+
+// NeutralizeDelimiters escapes the "<" of any opening or closing tag named in
+// tags (case-insensitive) as "&lt;", so untrusted file content cannot close
+// the block it is wrapped in and smuggle instructions to the model.
+func NeutralizeDelimiters(text string, tags ...string) string {
+	quoted := make([]string, len(tags))
+	for i, tag := range tags {
+		quoted[i] = regexp.QuoteMeta(tag)
+	}
+	pattern := regexp.MustCompile(`(?i)<(\s*/?\s*(?:` + strings.Join(quoted, "|") + `)\b)`)
+	return pattern.ReplaceAllString(text, "&lt;$1")
+}
+
+// ValidateContentTag checks a -content-tag value: a letter followed by
+// letters, digits, underscores or hyphens.
+func ValidateContentTag(tag string) error {
+	if !contentTagPattern.MatchString(tag) {
+		return fmt.Errorf("invalid content tag %q: use letters, digits, '_' or '-', starting with a letter", tag)
+	}
+	return nil
+}
+
+type tagsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+// modelNotFound builds an actionable error for a model that is not pulled,
+// listing the installed models when the server reports them.
+func (c *client) modelNotFound(model string) error {
+	var installed string
+	if names, err := c.listModels(); err == nil && len(names) > 0 {
+		installed = " (installed: " + strings.Join(names, ", ") + ")"
+	}
+	return fmt.Errorf("%w: %q; run 'ollama pull %s' or check -model%s", ErrModelNotFound, model, model, installed)
+}
+
+func (c *client) listModels() ([]string, error) {
+	uri := *c.uri
+	uri.Path = "/api/tags"
+	req, err := http.NewRequestWithContext(c.context(), http.MethodGet, uri.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("list models failed (%d)", resp.StatusCode)
+	}
+	var decoded tagsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(decoded.Models))
+	for _, m := range decoded.Models {
+		names = append(names, m.Name)
+	}
+	return names, nil
+}
+
+// SuggestName asks the model for a name and re-prompts up to opts.Retries
+// times while the answer fails ValidateSuggestion. Each retry shows the model
+// its rejected answer with a correction for the reason it failed (see
+// Correction) and raises the temperature by opts.TempStep (capped at
+// opts.MaxTemp) so a deterministic model does not repeat the same bad answer.
+// With opts.RotatePrompts each retry also asks in other words (see
+// RetryInstruction).
+// If every attempt is invalid the last answer is returned for SanitizeName to
+// clean up. opts.RetryTimeout bounds the time spent on all attempts together:
+// no re-prompt, HTTP retry or empty retry starts after it has passed.
+func (c *client) SuggestName(opts Options, path, content string) (string, error) {
+	c = c.withRetryBudget(opts)
+	var raw string
+	var followUp []chatMessage
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		if attempt > 0 && !c.canRetry(0) {
+			slog.Debug("retry timeout reached", "path", path, "attempt", attempt)
+			break
+		}
+		attemptOpts := opts
+		attemptOpts.Temperature = EscalateTemperature(opts.Temperature, opts.TempStep, opts.MaxTemp, attempt)
+		instruction := RetryInstruction(opts, attempt)
+		name, err := c.generate(attemptOpts, path, content, instruction, followUp)
+		if err != nil {
+			return "", err
+		}
+		raw = name
+		_, err = ValidateFor(opts, name)
+		if err == nil {
+			if instruction != "" {
+				slog.Debug("rephrased prompt accepted", "path", path, "attempt", attempt, "prompt", instruction)
+			}
+			return name, nil
+		}
+		var invalid *SuggestionError
+		if errors.As(err, &invalid) {
+			slog.Debug("invalid suggestion, correcting", "path", path, "reason", invalid.Reason, "answer", name)
+			followUp = []chatMessage{
+				{Role: "assistant", Content: name},
+				{Role: "user", Content: Correction(invalid)},
+			}
+		}
+	}
+	return raw, nil
+}
+
+// DefaultRetryPrompts are the rephrased openings of the user prompt that
+// retries rotate through with opts.RotatePrompts, unless opts.RetryPrompts
+// gives others.
+var DefaultRetryPrompts = []string{
+	"Read the text below and reply with a short file name that says what it is about.",
+	"What is this text about? Answer with a file name of a few words and nothing else.",
+	"Summarize the following content as a file name.",
+}
+
+// RetryInstruction returns the opening line of the user prompt for the given
+// zero-based attempt: "" for the usual wording, or with opts.RotatePrompts
+// the next of opts.RetryPrompts (DefaultRetryPrompts when empty) for each
+// retry, starting over after the last. -base-name-only keeps its own prompt.
+func RetryInstruction(opts Options, attempt int) string {
+	if !opts.RotatePrompts || attempt == 0 || opts.BaseNameOnly {
+		return ""
+	}
+	prompts := opts.RetryPrompts
+	if len(prompts) == 0 {
+		prompts = DefaultRetryPrompts
+	}
+	return prompts[(attempt-1)%len(prompts)]
+}
+
+// Correction returns the follow-up prompt asking the model to fix the problem
+// err reports, so a retry addresses the actual failure instead of starting
+// over.
+func Correction(err *SuggestionError) string {
+	switch err.Reason {
+	case ReasonEmpty:
+		return "Your answer was empty. Reply with exactly one file name."
+	case ReasonPath:
+		return "That is a path or URL, not a file name. Reply with only the name for the file, without any directory, scheme or extension."
+	case ReasonTooLong:
+		return fmt.Sprintf("That name has %d characters. Make it shorter: at most %d characters. Reply with the name only.", utf8.RuneCountInString(err.Raw), maxNameLength)
+	default:
+		return fmt.Sprintf("That name contains characters that are not allowed. Use only lowercase a-z, 0-9 and _, at most %d characters, on a single line. Reply with the name only.", maxNameLength)
 	}
 }
 
-func ReadSample(path string) (string, error) {
+// EscalateTemperature returns the temperature for the given zero-based
+// attempt: base, base+step, base+2*step, ... never exceeding max. A base
+// already above max is left as is.
+func EscalateTemperature(base, step, max float64, attempt int) float64 {
+	temp := base + float64(attempt)*step
+	if limit := math.Max(base, max); temp > limit {
+		return limit
+	}
+	return temp
+}
+
+// ParseOptionsJSON decodes a raw JSON object of extra Ollama options.
+func ParseOptionsJSON(raw string) (map[string]any, error) {
+	var decoded any
+	if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+		return nil, fmt.Errorf("invalid options JSON: %w", err)
+	}
+	obj, ok := decoded.(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid options JSON: must be a JSON object")
+	}
+	return obj, nil
+}
+
+// ReadSample returns up to readChars runes from the start of the file at path.
+// When opts.TrimAtNewline is set and the file is longer than the window, the
+// sample is cut back to the last newline so the model only sees whole lines;
+// opts.TrimAtSentence cuts it back to the last sentence end instead.
+// With opts.HeadTailSplit, part of the sample of a longer file comes from its
+// end instead; see headTailSample.
+// At debug level it logs the sniffed content type, the bytes read and the
+// runes kept, to explain poor names caused by the sample. The bytes are
+// decoded from opts.SampleEncoding first. Gzip-compressed files are sampled
+// from their decompressed text. With opts.ReadArchives, archives are sampled
+// with ArchiveSample instead. With opts.ContentSource metadata or auto, files
+// with tags are sampled with MetadataSample; with metadata, a file without
+// them gives an empty sample.
+func ReadSample(path string, opts Options) (string, error) {
+	if opts.ReadArchives && IsArchive(path) {
+		summary, err := ArchiveSample(path)
+		if err != nil {
+			return "", err
+		}
+		if runes := []rune(summary); len(runes) > readChars {
+			summary = string(runes[:readChars])
+		}
+		return summary, nil
+	}
+	if useMetadata(opts) {
+		tags, ok, err := MetadataSample(path)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			if runes := []rune(tags); len(runes) > readChars {
+				tags = string(runes[:readChars])
+			}
+			return tags, nil
+		}
+		if opts.ContentSource == ContentSourceMetadata {
+			return "", nil
+		}
+	}
+
 	f, err := os.Open(path)
 	if err != nil {
 		return "", fmt.Errorf("open file: %w", err)
 	}
 	defer f.Close()
-
-	buf, err := io.ReadAll(io.LimitReader(f, int64(readChars*utf8.UTFMax)))
+	r, closeReader, err := sampleReader(path, f)
 	if err != nil {
+		return "", err
+	}
+	defer closeReader()
+
+	// Read one byte past the window so a file that fills it exactly can still
+	// be told apart from a longer one.
+	window := int64(readChars * utf8.UTFMax)
+	rewrite := opts.NormalizeWhitespace || opts.StripEmoji || len(opts.Prefilters) > 0
+	if rewrite {
+		// Normalization, emoji stripping and prefilters can shrink the text a lot, so read
+		// further ahead to still fill the sample.
+		window *= normalizeReadFactor
+	}
+	buf, err := io.ReadAll(io.LimitReader(r, window+1))
+	// A gzip file cut short, such as a log still being written, keeps
+	// the text inflated so far.
+	if err != nil && !(errors.Is(err, io.ErrUnexpectedEOF) && len(buf) > 0) {
 		return "", fmt.Errorf("read file: %w", err)
 	}
+	bytesRead := len(buf)
+	contentType := http.DetectContentType(buf)
+	buf = DecodeSample(buf, opts.SampleEncoding)
+
+	truncated := false
+	if rewrite {
+		truncated = int64(bytesRead) > window
+		if int64(len(buf)) > window {
+			buf = dropPartialRune(buf[:window])
+		}
+		buf = []byte(rewriteSample(string(buf), opts))
+	}
 
 	byteIndex := 0
 	for runeCount := 0; runeCount < readChars && byteIndex < len(buf); runeCount++ {
@@ -202,18 +1074,163 @@ func ReadSample(path string) (string, error) {
 		byteIndex += size
 	}
 
-	return string(buf[:byteIndex]), nil
+	sample := string(buf[:byteIndex])
+	truncated = truncated || byteIndex < len(buf)
+	whole := int64(bytesRead) <= window
+	// A compressed stream cannot be read from the end, so only a file that
+	// fit in the window gets its end sampled.
+	_, compressed := r.(*gzip.Reader)
+	switch {
+	case truncated && useHeadTail(opts) && (whole || !compressed):
+		if sample, err = headTailSample(f, buf, whole, int64(bytesRead), window, opts); err != nil {
+			return "", err
+		}
+	case opts.TrimAtSentence && truncated:
+		sample = TrimToLastSentence(sample)
+	case opts.TrimAtNewline && truncated:
+		sample = TrimToLastLine(sample)
+	}
+	slog.Debug("sample", "path", path, "content_type", contentType, "bytes_read", bytesRead,
+		"runes", utf8.RuneCountInString(sample), "truncated", truncated)
+	return sample, nil
+}
+
+// rewriteSample applies opts.Prefilters, -strip-emoji and
+// -normalize-whitespace to text.
+func rewriteSample(text string, opts Options) string {
+	text = Prefilter(text, opts.Prefilters)
+	if opts.StripEmoji {
+		text = StripEmoji(text)
+	}
+	if opts.NormalizeWhitespace {
+		text = NormalizeWhitespace(text)
+	}
+	return text
+}
+
+// dropPartialRune removes an incomplete UTF-8 sequence left at the end of buf
+// by a byte-limited read.
+func dropPartialRune(buf []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(buf); i++ {
+		if utf8.RuneStart(buf[len(buf)-i]) {
+			if !utf8.FullRune(buf[len(buf)-i:]) {
+				return buf[:len(buf)-i]
+			}
+			break
+		}
+	}
+	return buf
+}
+
+// NormalizeWhitespace collapses runs of spaces and tabs within each line to a
+// single space and drops blank lines.
+func NormalizeWhitespace(text string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(strings.Join(fields, " "))
+	}
+	if b.Len() > 0 && strings.HasSuffix(text, "\n") {
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// TrimToLastLine drops any partial line after the last newline. Samples
+// without a newline are returned unchanged.
+func TrimToLastLine(sample string) string {
+	if idx := strings.LastIndexByte(sample, '\n'); idx >= 0 {
+		return sample[:idx+1]
+	}
+	return sample
+}
+
+// TrimLeadingName removes the file's current name from the start of sample,
+// as exported notes often begin with their own title, so the model names the
+// substance instead of echoing the old name. The name matches with or without
+// its extension, ignoring case, leading "#" heading marks, and the difference
+// between "_", "-", "." and spaces. A sample that is nothing but the name is
+// returned unchanged.
+func TrimLeadingName(sample, path string) string {
+	base := filepath.Base(path)
+	start := strings.TrimLeft(sample, " \t\r\n#")
+	for _, name := range []string{base, strings.TrimSuffix(base, Ext(path)), strings.TrimSuffix(base, filepath.Ext(base))} {
+		if name == "" {
+			continue
+		}
+		n, ok := matchLeadingName(start, name)
+		if !ok {
+			continue
+		}
+		rest := strings.TrimLeft(start[n:], " \t\r\n:-")
+		if strings.TrimSpace(rest) == "" {
+			return sample
+		}
+		return rest
+	}
+	return sample
+}
+
+// matchLeadingName reports whether s starts with name as a whole word and
+// how many bytes of s it spans.
+func matchLeadingName(s, name string) (int, bool) {
+	i := 0
+	for _, want := range name {
+		if i >= len(s) {
+			return 0, false
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !strings.EqualFold(string(r), string(want)) && !(isNameSeparator(r) && isNameSeparator(want)) {
+			return 0, false
+		}
+		i += size
+	}
+	if r, _ := utf8.DecodeRuneInString(s[i:]); i < len(s) && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+		return 0, false
+	}
+	return i, true
+}
+
+func isNameSeparator(r rune) bool {
+	return r == '_' || r == '-' || r == '.' || r == ' '
+}
+
+// Prefilter removes every match of each pattern from text, in order, for
+// -prefilter.
+func Prefilter(text string, patterns []*regexp.Regexp) string {
+	for _, pattern := range patterns {
+		text = pattern.ReplaceAllString(text, "")
+	}
+	return text
+}
+
+// RepairUTF8 replaces invalid UTF-8 sequences in sample with U+FFFD, for
+// -lenient-utf8. A warning is logged when anything had to be replaced.
+func RepairUTF8(sample, path string) string {
+	if utf8.ValidString(sample) {
+		return sample
+	}
+	slog.Warn("replaced invalid UTF-8 in sample", "path", path)
+	return strings.ToValidUTF8(sample, string(utf8.RuneError))
 }
 
+// EnsureTextSample rejects samples that do not look like text with an error
+// wrapping ErrNotText. An empty sample returns ErrEmptySample.
 func EnsureTextSample(sample string, path string) (string, error) {
 	if sample == "" {
-		return "", nil
+		return "", ErrEmptySample
 	}
 	if strings.ContainsRune(sample, '\x00') {
-		return "", fmt.Errorf("%s does not look like a text file (NUL byte found)", path)
+		return "", fmt.Errorf("%w: %s does not look like a text file (NUL byte found)", ErrNotText, path)
 	}
 	if !utf8.ValidString(sample) {
-		return "", fmt.Errorf("%s is not valid UTF-8 text", path)
+		return "", fmt.Errorf("%w: %s is not valid UTF-8 text", ErrNotText, path)
 	}
 	return sample, nil
 }
@@ -243,50 +1260,379 @@ func ApplyPrefix(prefix, name string) string {
 	return prefix + name
 }
 
-func DestinationPath(path, newName, destDir string) string {
-	dir := destDir
-	if dir == "" {
-		dir = filepath.Dir(path)
+// defaultDatePattern finds a leading ISO date such as "2024-01-15 - scan".
+var defaultDatePattern = regexp.MustCompile(DefaultDatePattern)
+
+// DatePrefix returns the date found at the start of path's file name when
+// opts.PreserveDatePrefix is set, or "" otherwise. opts.DatePattern overrides
+// the default ISO date pattern; its first capture group, if any, is the date.
+// Any run of characters other than letters and digits becomes a single
+// hyphen, so "2024.01.15" is kept as "2024-01-15" instead of being sanitized.
+func DatePrefix(path string, opts Options) string {
+	if !opts.PreserveDatePrefix {
+		return ""
+	}
+	pattern := opts.DatePattern
+	if pattern == nil {
+		pattern = defaultDatePattern
+	}
+	match := pattern.FindStringSubmatch(filepath.Base(path))
+	if match == nil {
+		return ""
+	}
+	date := match[0]
+	if len(match) > 1 && match[1] != "" {
+		date = match[1]
+	}
+
+	var b strings.Builder
+	pendingHyphen := false
+	for _, r := range strings.ToLower(date) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pendingHyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			pendingHyphen = false
+			continue
+		}
+		pendingHyphen = true
+	}
+	return b.String()
+}
+
+// ApplyDatePrefix joins a preserved date and the generated name with an
+// underscore.
+func ApplyDatePrefix(date, name string) string {
+	if date == "" {
+		return name
+	}
+	return date + "_" + name
+}
+
+// DestinationDir returns the directory path is renamed into: opts.Dir, or
+// the source's own directory without it. With opts.PreserveTree, the path of
+// the source below the opts.TreeRoots entry containing it is recreated under
+// opts.Dir; sources outside every root land directly in opts.Dir.
+func DestinationDir(path string, opts Options) string {
+	if opts.Dir == "" {
+		return filepath.Dir(path)
+	}
+	if !opts.PreserveTree {
+		return opts.Dir
+	}
+	best := ""
+	for _, root := range opts.TreeRoots {
+		rel, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if best == "" || len(rel) < len(best) {
+			best = rel
+		}
+	}
+	if best == "" {
+		return opts.Dir
+	}
+	return filepath.Join(opts.Dir, best)
+}
+
+// DestinationPath returns where path ends up when renamed to newName: in
+// opts.Dir (or next to the source), keeping the extension unless
+// opts.ExtRewrites maps it to another one or, with opts.AllowExt, newName
+// already carries an allowed extension suggested by the model. A newName
+// that fails CheckBaseName is an error.
+func DestinationPath(path, newName string, opts Options) (string, error) {
+	if err := CheckBaseName(newName); err != nil {
+		return "", err
+	}
+	dir := DestinationDir(path, opts)
+	if opts.AllowExt {
+		if _, ext := SplitExtension(newName, opts.AllowedExts); ext != "" {
+			return filepath.Join(dir, newName), nil
+		}
+	}
+	ext := RewriteExt(Ext(path), opts.ExtRewrites)
+	return filepath.Join(dir, newName+ext), nil
+}
+
+// CheckBaseName rejects a computed file name that could leave the target
+// directory: one containing a path separator, or that is empty, "." or "..".
+// The error wraps ErrUnsafeName. It guards the join in DestinationPath no
+// matter how the name was sanitized.
+func CheckBaseName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) || strings.ContainsRune(name, os.PathSeparator) {
+		return fmt.Errorf("%w: %q", ErrUnsafeName, name)
+	}
+	return nil
+}
+
+// RewriteExt returns the replacement for ext from rewrites, matching
+// case-insensitively. Extensions without a mapping are returned unchanged.
+// Keys are expected in the form produced by NormalizeExt.
+func RewriteExt(ext string, rewrites map[string]string) string {
+	if replacement, ok := rewrites[NormalizeExt(ext)]; ok {
+		return replacement
+	}
+	return ext
+}
+
+// NormalizeExt lowercases ext and ensures it starts with a dot.
+func NormalizeExt(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// SplitExtension separates a trailing extension from a model suggestion when
+// it is in allowed (case-insensitive, without dots). The extension is
+// returned lowercased with its dot; otherwise ext is empty and base is raw.
+func SplitExtension(raw string, allowed []string) (base, ext string) {
+	trimmed := strings.TrimSpace(raw)
+	idx := strings.LastIndexByte(trimmed, '.')
+	if idx <= 0 || idx == len(trimmed)-1 {
+		return raw, ""
+	}
+	candidate := strings.ToLower(trimmed[idx+1:])
+	for _, a := range allowed {
+		if strings.TrimPrefix(strings.ToLower(a), ".") == candidate {
+			return trimmed[:idx], "." + candidate
+		}
+	}
+	return raw, ""
+}
+
+// SanitizeSuggestion turns raw model output into the new base name for opts.
+// The name goes through opts.Sanitizer (SanitizeName when nil). With
+// opts.AllowExt an allowed trailing extension is kept after it. With
+// opts.StripEmoji emoji are dropped first, so they do not become underscores.
+// opts.FlattenSeparators, when set, then joins the words of the name with it.
+func SanitizeSuggestion(raw string, opts Options) string {
+	if opts.StripEmoji {
+		raw = StripEmoji(raw)
+	}
+	sanitize := SanitizeName
+	if opts.Sanitizer != nil {
+		sanitize = opts.Sanitizer.Sanitize
+	}
+	if opts.NoExtensionStrip {
+		sanitize = sanitizeVerbatimOrDefault
+	}
+	if opts.StripNumbers {
+		sanitizeName := sanitize
+		sanitize = func(raw string) string {
+			return StripNumberSuffix(sanitizeName(raw), opts.KeepNumbers)
+		}
+	}
+	if opts.FlattenSeparators != "" {
+		sanitizeName := sanitize
+		sanitize = func(raw string) string {
+			return FlattenSeparators(sanitizeName(raw), opts.FlattenSeparators)
+		}
+	}
+	if !opts.AllowExt {
+		return sanitize(raw)
+	}
+	base, ext := SplitExtension(firstLine(raw), opts.AllowedExts)
+	return sanitize(base) + ext
+}
+
+// defaultKeepNumbers keeps years such as "report_2024".
+var defaultKeepNumbers = regexp.MustCompile(DefaultKeepNumbers)
+
+// StripNumberSuffix drops one trailing "_N" or "-N" from name, as in
+// "report_2", unless the digits match keep (nil means DefaultKeepNumbers) or
+// nothing would be left.
+func StripNumberSuffix(name string, keep *regexp.Regexp) string {
+	if keep == nil {
+		keep = defaultKeepNumbers
+	}
+	i := strings.LastIndexAny(name, "_-")
+	if i <= 0 || i == len(name)-1 {
+		return name
+	}
+	digits := name[i+1:]
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return name
+		}
+	}
+	if keep.MatchString(digits) {
+		return name
+	}
+	return name[:i]
+}
+
+// maxVerbatimBytes keeps verbatim names, plus an extension, within the
+// 255-byte file name limit of common filesystems.
+const maxVerbatimBytes = 200
+
+// SanitizeVerbatim is the -no-extension-strip counterpart of SanitizeName: it
+// keeps the first line of raw as written, removing only what is dangerous in
+// a file name. Path separators, NUL and other control characters are
+// dropped, and leading dots are trimmed so the result can be neither "." nor
+// ".." nor a hidden file. No case, charset or length rules beyond the
+// filesystem limit apply. It returns "" when nothing usable is left.
+func SanitizeVerbatim(raw string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, firstLine(raw))
+	name = strings.TrimLeft(strings.TrimSpace(name), ". ")
+	for len(name) > maxVerbatimBytes {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return strings.TrimSpace(name)
+}
+
+func sanitizeVerbatimOrDefault(raw string) string {
+	if name := SanitizeVerbatim(raw); name != "" {
+		return name
+	}
+	return "file"
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if idx := strings.IndexByte(s, '\n'); idx >= 0 {
+		return s[:idx]
 	}
-	ext := filepath.Ext(path)
-	return filepath.Join(dir, newName+ext)
+	return s
+}
+
+// ValidateFor applies ValidateSuggestion to raw, ignoring an allowed
+// extension when opts.AllowExt is set. With opts.NoExtensionStrip only an
+// empty name is invalid. With opts.StripEmoji raw is checked without its
+// emoji.
+func ValidateFor(opts Options, raw string) (string, error) {
+	if opts.StripEmoji {
+		raw = StripEmoji(raw)
+	}
+	if trimmed := strings.TrimSpace(raw); pathAnswer.MatchString(trimmed) {
+		// Checked before anything else: sanitizing a path or URL would turn
+		// it into a name made of its slashes and directories.
+		return "", &SuggestionError{Raw: trimmed, Reason: ReasonPath}
+	}
+	if opts.NoExtensionStrip {
+		// Verbatim names only have to survive SanitizeVerbatim.
+		if name := SanitizeVerbatim(raw); name != "" {
+			return name, nil
+		}
+		return "", &SuggestionError{Raw: raw, Reason: ReasonEmpty}
+	}
+	if !opts.AllowExt {
+		return ValidateSuggestion(raw)
+	}
+	base, ext := SplitExtension(raw, opts.AllowedExts)
+	name, err := ValidateSuggestion(base)
+	if err != nil {
+		return "", err
+	}
+	return name + ext, nil
 }
 
 // ValidateSuggestion ensures the raw model output follows the naming rules strictly.
 // It returns the trimmed suggestion if valid.
 func ValidateSuggestion(raw string) (string, error) {
 	trimmed := strings.TrimSpace(raw)
-	if trimmed == "" {
-		return "", errors.New("empty suggestion")
-	}
-	if !namePattern.MatchString(trimmed) {
-		return "", fmt.Errorf("suggestion %q does not match required pattern %s", trimmed, namePattern.String())
+	switch {
+	case trimmed == "":
+		return "", &SuggestionError{Raw: raw, Reason: ReasonEmpty}
+	case !nameChars.MatchString(trimmed):
+		return "", &SuggestionError{Raw: trimmed, Reason: ReasonInvalidChars}
+	case !namePattern.MatchString(trimmed):
+		return "", &SuggestionError{Raw: trimmed, Reason: ReasonTooLong}
 	}
 	return trimmed, nil
 }
 
-func RenameFile(path, newName, destDir string) error {
-	destination := DestinationPath(path, newName, destDir)
-
+// SamePath reports whether path and destination name the same file, meaning
+// a rename would leave the file where it already is. Besides comparing
+// absolute paths it resolves symlinks in both directories, so a -dir that
+// reaches the source directory through a symlink is still detected. The base
+// names must match exactly: a hard link, or a name differing only in case on
+// a case-insensitive filesystem, is a real rename.
+func SamePath(path, destination string) (bool, error) {
 	absSrc, err := filepath.Abs(path)
 	if err != nil {
-		return fmt.Errorf("absolutize source: %w", err)
+		return false, fmt.Errorf("absolutize source: %w", err)
 	}
 	absDst, err := filepath.Abs(destination)
 	if err != nil {
-		return fmt.Errorf("absolutize destination: %w", err)
+		return false, fmt.Errorf("absolutize destination: %w", err)
 	}
 	if absSrc == absDst {
-		fmt.Printf("%s -> %s\n", path, destination)
+		return true, nil
+	}
+	if filepath.Base(absSrc) != filepath.Base(absDst) {
+		return false, nil
+	}
+	srcDir, err := filepath.EvalSymlinks(filepath.Dir(absSrc))
+	if err != nil {
+		return false, nil
+	}
+	dstDir, err := filepath.EvalSymlinks(filepath.Dir(absDst))
+	if err != nil {
+		return false, nil
+	}
+	return srcDir == dstDir, nil
+}
+
+// RenameFile moves path to its new name, keeping the extension. With
+// opts.Link or opts.Symlink the original stays in place and a hard or
+// symbolic link is created under the new name instead. With
+// opts.PreserveOriginalXattr the original path is kept in the OriginalXattr
+// attribute of the renamed file. It is a no-op when the destination is the
+// file itself.
+func RenameFile(path, newName string, opts Options) error {
+	destination, err := DestinationPath(path, newName, opts)
+	if err != nil {
+		return err
+	}
+
+	same, err := SamePath(path, destination)
+	if err != nil {
+		return err
+	}
+	if same {
 		return nil
 	}
 	if _, err := os.Stat(destination); err == nil {
-		return fmt.Errorf("destination already exists - %s", destination)
+		return fmt.Errorf("%w - %s", ErrDestinationExists, destination)
+	}
+	if opts.PreserveTree {
+		if err := os.MkdirAll(filepath.Dir(destination), 0o755); err != nil {
+			return fmt.Errorf("create directory: %w", err)
+		}
 	}
 
-	if err := os.Rename(path, destination); err != nil {
-		return fmt.Errorf("rename: %w", err)
+	switch {
+	case opts.Link:
+		if err := os.Link(path, destination); err != nil {
+			return fmt.Errorf("hardlink: %w (hardlinks need both paths on the same filesystem and OS support)", err)
+		}
+	case opts.Symlink:
+		target, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("absolutize source: %w", err)
+		}
+		if err := os.Symlink(target, destination); err != nil {
+			return fmt.Errorf("symlink: %w", err)
+		}
+	default:
+		if err := os.Rename(path, destination); err != nil {
+			return fmt.Errorf("rename: %w", err)
+		}
+	}
+	// A symlink has no attributes of its own; setting one would change the
+	// original instead.
+	if opts.PreserveOriginalXattr && !opts.Symlink {
+		recordOriginal(path, destination)
 	}
-	fmt.Printf("%s -> %s\n", path, destination)
 	return nil
 }
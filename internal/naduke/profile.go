@@ -0,0 +1,100 @@
+package naduke
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Prompt profiles select the naming guidance sent in the system prompt.
+const (
+	ProfileAuto  = "auto"
+	ProfileProse = "prose"
+	ProfileCode  = "code"
+)
+
+const (
+	proseGuidance = "- Make it concise but descriptive of the text content."
+	codeGuidance  = "- This is source code: name it after its purpose (the module, type, or main function it provides), not its language or syntax."
+	// codeLineRatio is the share of code-looking lines above which content
+	// without a known extension is treated as code.
+	codeLineRatio = 0.3
+)
+
+var (
+	codeExts = map[string]bool{
+		".go": true, ".py": true, ".js": true, ".jsx": true, ".ts": true, ".tsx": true,
+		".rb": true, ".rs": true, ".java": true, ".kt": true, ".swift": true, ".c": true,
+		".h": true, ".cc": true, ".cpp": true, ".hpp": true, ".cs": true, ".php": true,
+		".sh": true, ".bash": true, ".zsh": true, ".pl": true, ".lua": true, ".scala": true,
+		".sql": true,
+	}
+	proseExts = map[string]bool{
+		".txt": true, ".md": true, ".markdown": true, ".rst": true, ".org": true, ".tex": true,
+		".adoc": true, ".html": true, ".htm": true, ".eml": true,
+	}
+	codePrefixes = []string{
+		"package ", "import ", "from ", "func ", "def ", "class ", "#include", "using ",
+		"const ", "let ", "var ", "return ", "fn ", "pub ", "public ", "private ", "#!/",
+	}
+)
+
+// ParseProfile validates a -prompt-profile value.
+func ParseProfile(value string) (string, error) {
+	switch value {
+	case ProfileAuto, ProfileProse, ProfileCode:
+		return value, nil
+	default:
+		return "", fmt.Errorf("unknown prompt profile %q (want %s, %s or %s)", value, ProfileAuto, ProfileProse, ProfileCode)
+	}
+}
+
+// ResolveProfile returns the prompt profile for a file: the forced profile
+// when one is set, otherwise the result of DetectProfile.
+func ResolveProfile(forced, path, content string) string {
+	if forced != "" && forced != ProfileAuto {
+		return forced
+	}
+	return DetectProfile(path, content)
+}
+
+// DetectProfile guesses whether a file is source code or prose, first from
+// its extension and then from how many lines look like code.
+func DetectProfile(path, content string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch {
+	case codeExts[ext]:
+		return ProfileCode
+	case proseExts[ext]:
+		return ProfileProse
+	}
+
+	lines, codeLines := 0, 0
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		lines++
+		if looksLikeCode(line) {
+			codeLines++
+		}
+	}
+	if lines > 0 && float64(codeLines)/float64(lines) >= codeLineRatio {
+		return ProfileCode
+	}
+	return ProfileProse
+}
+
+func looksLikeCode(line string) bool {
+	switch line[len(line)-1] {
+	case ';', '{', '}', ')':
+		return true
+	}
+	for _, prefix := range codePrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
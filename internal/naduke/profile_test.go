@@ -0,0 +1,55 @@
+package naduke
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectProfile(t *testing.T) {
+	t.Parallel()
+
+	goSource := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n"
+	prose := "Dear team,\nThe quarterly review is scheduled for Friday.\nPlease bring your notes.\n"
+
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		want    string
+	}{
+		{"code extension", "main.go", prose, ProfileCode},
+		{"prose extension", "notes.md", goSource, ProfileProse},
+		{"unknown extension code", "snippet", goSource, ProfileCode},
+		{"unknown extension prose", "letter", prose, ProfileProse},
+		{"empty", "empty", "", ProfileProse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectProfile(tt.path, tt.content); got != tt.want {
+				t.Fatalf("DetectProfile(%q) = %q; want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+
+	if got := ResolveProfile(ProfileProse, "main.go", goSource); got != ProfileProse {
+		t.Fatalf("forced profile should win, got %q", got)
+	}
+	if _, err := ParseProfile("poetry"); err == nil {
+		t.Fatalf("expected error for unknown profile")
+	}
+}
+
+func TestSystemMessageProfile(t *testing.T) {
+	t.Parallel()
+
+	if got := systemMessage(Options{}, ProfileProse); !strings.Contains(got, proseGuidance) {
+		t.Fatalf("prose prompt missing guidance: %q", got)
+	}
+	code := systemMessage(Options{}, ProfileCode)
+	if !strings.Contains(code, codeGuidance) || strings.Contains(code, proseGuidance) {
+		t.Fatalf("code prompt should replace the prose guidance: %q", code)
+	}
+	if !strings.Contains(systemMessage(Options{AllowExt: true}, ProfileCode), codeGuidance) {
+		t.Fatalf("code guidance should also apply with -allow-ext")
+	}
+}
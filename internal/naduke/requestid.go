@@ -0,0 +1,63 @@
+package naduke
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultRequestIDHeader and DefaultRequestIDTemplate are used by -request-id.
+const (
+	DefaultRequestIDHeader   = "X-Request-Id"
+	DefaultRequestIDTemplate = "{uuid}"
+)
+
+// requestHeader returns the extra headers for the requests naming path: the
+// correlation id from opts.RequestIDTemplate under opts.RequestIDHeader when
+// opts.RequestID is set, or nil.
+func requestHeader(opts Options, path string) http.Header {
+	if !opts.RequestID {
+		return nil
+	}
+	name := opts.RequestIDHeader
+	if name == "" {
+		name = DefaultRequestIDHeader
+	}
+	template := opts.RequestIDTemplate
+	if template == "" {
+		template = DefaultRequestIDTemplate
+	}
+	header := make(http.Header)
+	header.Set(name, RequestID(template, path))
+	return header
+}
+
+// RequestID expands template for the file at path: {uuid} becomes a new
+// random UUID, {file} the base name and {path} the path as given. Control
+// characters, which cannot appear in a header value, become "_".
+func RequestID(template, path string) string {
+	id := strings.NewReplacer(
+		"{file}", filepath.Base(path),
+		"{path}", path,
+	).Replace(template)
+	for strings.Contains(id, "{uuid}") {
+		id = strings.Replace(id, "{uuid}", newUUID(), 1)
+	}
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, id)
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
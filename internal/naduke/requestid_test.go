@@ -0,0 +1,63 @@
+package naduke
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestID(t *testing.T) {
+	t.Parallel()
+
+	if id := RequestID("{uuid}", "notes.txt"); !uuidPattern.MatchString(id) {
+		t.Fatalf("RequestID({uuid}) = %q; want a v4 UUID", id)
+	}
+	if a, b := RequestID("{uuid}", "x"), RequestID("{uuid}", "x"); a == b {
+		t.Fatalf("expected a new UUID per call, got %q twice", a)
+	}
+	if id := RequestID("naduke-{file}", "docs/notes.txt"); id != "naduke-notes.txt" {
+		t.Fatalf("RequestID({file}) = %q", id)
+	}
+	if id := RequestID("{path}", "docs/bad\nname.txt"); id != "docs/bad_name.txt" {
+		t.Fatalf("RequestID should replace control characters, got %q", id)
+	}
+}
+
+func TestGenerateNameSendsRequestID(t *testing.T) {
+	t.Parallel()
+
+	var got []string
+	fakeTransport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		got = append(got, req.Header.Get("X-Trace"))
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"message":{"role":"assistant","content":"name"}}`)),
+			Header:     make(http.Header),
+		}, nil
+	})
+	client := &client{
+		http: &http.Client{Transport: fakeTransport},
+		uri:  &url.URL{Scheme: "http", Host: "example.com", Path: "/api/chat"},
+	}
+
+	opts := Options{Model: "m", RequestID: true, RequestIDHeader: "X-Trace", RequestIDTemplate: "{file}/{uuid}"}
+	if _, err := client.GenerateName(opts, "docs/notes.txt", "content"); err != nil {
+		t.Fatalf("GenerateName error: %v", err)
+	}
+	if len(got) != 1 || !strings.HasPrefix(got[0], "notes.txt/") || !uuidPattern.MatchString(strings.TrimPrefix(got[0], "notes.txt/")) {
+		t.Fatalf("unexpected request id header: %q", got)
+	}
+
+	got = nil
+	if _, err := client.GenerateName(Options{Model: "m"}, "docs/notes.txt", "content"); err != nil {
+		t.Fatalf("GenerateName error: %v", err)
+	}
+	if got[0] != "" {
+		t.Fatalf("expected no header without RequestID, got %q", got[0])
+	}
+}
@@ -0,0 +1,155 @@
+package naduke
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Sanitizer turns a model answer into the base name of a file. Library users
+// can set Options.Sanitizer to their own implementation; nil means SnakeCase.
+type Sanitizer interface {
+	Sanitize(raw string) string
+}
+
+// SanitizerFunc adapts a plain function to Sanitizer.
+type SanitizerFunc func(raw string) string
+
+func (f SanitizerFunc) Sanitize(raw string) string {
+	return f(raw)
+}
+
+// Built-in sanitizers selected by -style.
+var (
+	// SnakeCase is SanitizeName: lowercase a-z0-9 joined by "_".
+	SnakeCase Sanitizer = SanitizerFunc(SanitizeName)
+	// KebabCase is SnakeCase with "-" between words, as in URL slugs.
+	KebabCase Sanitizer = SanitizerFunc(func(raw string) string {
+		return strings.ReplaceAll(SanitizeName(raw), "_", "-")
+	})
+	// CamelCase joins the SnakeCase words as lowerCamelCase.
+	CamelCase Sanitizer = SanitizerFunc(func(raw string) string {
+		words := strings.Split(SanitizeName(raw), "_")
+		var b strings.Builder
+		for i, word := range words {
+			if i > 0 && word != "" {
+				word = strings.ToUpper(word[:1]) + word[1:]
+			}
+			b.WriteString(word)
+		}
+		return b.String()
+	})
+	// CodeCase is SanitizeCodeName, for names taken from source code and
+	// other technical content.
+	CodeCase Sanitizer = SanitizerFunc(SanitizeCodeName)
+)
+
+// Names for -style.
+const (
+	StyleSnake = "snake"
+	StyleKebab = "kebab"
+	StyleCamel = "camel"
+	StyleCode  = "code"
+)
+
+var styles = map[string]Sanitizer{
+	StyleSnake: SnakeCase,
+	StyleKebab: KebabCase,
+	StyleCamel: CamelCase,
+	StyleCode:  CodeCase,
+}
+
+// StyleSeparator returns the separator between words of a -style, or false
+// for camel, whose words are not separated, and unknown styles.
+func StyleSeparator(value string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case StyleSnake, StyleCode:
+		return "_", true
+	case StyleKebab:
+		return "-", true
+	}
+	return "", false
+}
+
+// FlattenSeparators replaces every run of hyphens, underscores, dots and
+// spaces in name with sep, and trims them from both ends, so "my-file_name"
+// and "my file.name" both become "my_file_name" for "_".
+func FlattenSeparators(name, sep string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '-' || r == '_' || r == '.' || unicode.IsSpace(r)
+	})
+	if len(words) == 0 {
+		return name
+	}
+	return strings.Join(words, sep)
+}
+
+// ParseStyle returns the built-in Sanitizer named by a -style value.
+func ParseStyle(value string) (Sanitizer, error) {
+	if s, ok := styles[strings.ToLower(strings.TrimSpace(value))]; ok {
+		return s, nil
+	}
+	names := make([]string, 0, len(styles))
+	for name := range styles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown style %q (want %s)", value, strings.Join(names, ", "))
+}
+
+// SanitizeCodeName is a snake_case transform that keeps the structure of
+// technical names instead of only replacing characters:
+//
+//  1. Only the first line counts; surrounding space is trimmed.
+//  2. A lowercase letter or digit followed by an uppercase letter, and an
+//     uppercase run followed by a capitalized word, start a new word:
+//     "parseHTTPRequest" becomes "parse_http_request".
+//  3. Letters are lowercased.
+//  4. A "." between two digits becomes "_", so "v2.1.0" is "v2_1_0" and
+//     never "v210".
+//  5. Every other run of characters outside a-z0-9 becomes a single "_",
+//     and "_" is trimmed from both ends.
+//  6. A name over 30 characters is cut at the last "_" within the limit, or
+//     at 30 characters when there is none, so words and version parts are
+//     not split.
+//
+// An empty result becomes "file", as with SanitizeName.
+func SanitizeCodeName(raw string) string {
+	raw = firstLine(strings.TrimSpace(raw))
+	runes := []rune(raw)
+	var b strings.Builder
+	pendingSep := false
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				pendingSep = true
+			}
+		}
+		r = unicode.ToLower(r)
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if pendingSep && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			pendingSep = false
+			continue
+		}
+		// Dots between digits, like every other separator, leave one "_".
+		pendingSep = true
+	}
+	name := b.String()
+	if len(name) > maxNameLength {
+		cut := name[:maxNameLength]
+		if i := strings.LastIndexByte(cut, '_'); i > 0 && name[maxNameLength] != '_' {
+			cut = cut[:i]
+		}
+		name = strings.TrimRight(cut, "_")
+	}
+	if name == "" {
+		return "file"
+	}
+	return name
+}
@@ -0,0 +1,112 @@
+package naduke
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStyles(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		style string
+		raw   string
+		want  string
+	}{
+		{StyleSnake, "Meeting Notes 2024", "meeting_notes_2024"},
+		{StyleKebab, "Meeting Notes 2024", "meeting-notes-2024"},
+		{StyleCamel, "Meeting Notes 2024", "meetingNotes2024"},
+		{StyleCamel, "  ", "file"},
+		{"KEBAB", "Draft Plan", "draft-plan"},
+	}
+	for _, tt := range tests {
+		sanitizer, err := ParseStyle(tt.style)
+		if err != nil {
+			t.Fatalf("ParseStyle(%q) error: %v", tt.style, err)
+		}
+		if got := sanitizer.Sanitize(tt.raw); got != tt.want {
+			t.Fatalf("%s.Sanitize(%q) = %q; want %q", tt.style, tt.raw, got, tt.want)
+		}
+	}
+
+	if _, err := ParseStyle("title"); err == nil || !strings.Contains(err.Error(), "camel, code, kebab, snake") {
+		t.Fatalf("expected unknown style error listing styles, got %v", err)
+	}
+}
+
+func TestSanitizeSuggestionCustomSanitizer(t *testing.T) {
+	t.Parallel()
+
+	upper := SanitizerFunc(func(raw string) string { return strings.ToUpper(strings.TrimSpace(raw)) })
+	opts := Options{Sanitizer: upper, AllowExt: true, AllowedExts: []string{"csv"}}
+	if got := SanitizeSuggestion("report.csv", opts); got != "REPORT.csv" {
+		t.Fatalf("SanitizeSuggestion with custom sanitizer = %q; want REPORT.csv", got)
+	}
+	if got := SanitizeSuggestion("Report Draft", Options{}); got != "report_draft" {
+		t.Fatalf("SanitizeSuggestion without sanitizer = %q; want report_draft", got)
+	}
+}
+
+func TestFlattenSeparators(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		sep  string
+		want string
+	}{
+		{"my-file_name", "_", "my_file_name"},
+		{"my file.name", "_", "my_file_name"},
+		{"release.v2 - notes__final", "-", "release-v2-notes-final"},
+		{"-_.draft plan._-", "_", "draft_plan"},
+		{"meeting_notes", "_", "meeting_notes"},
+		{"---", "_", "---"},
+	}
+	for _, tt := range tests {
+		if got := FlattenSeparators(tt.name, tt.sep); got != tt.want {
+			t.Fatalf("FlattenSeparators(%q, %q) = %q; want %q", tt.name, tt.sep, got, tt.want)
+		}
+	}
+
+	if got := SanitizeSuggestion("Q3 Sales-Report.final", Options{NoExtensionStrip: true, FlattenSeparators: "_"}); got != "Q3_Sales_Report_final" {
+		t.Fatalf("SanitizeSuggestion verbatim = %q; want Q3_Sales_Report_final", got)
+	}
+	opts := Options{Sanitizer: SanitizerFunc(strings.TrimSpace), FlattenSeparators: "-", AllowExt: true, AllowedExts: []string{"md"}}
+	if got := SanitizeSuggestion("draft_plan v2.md", opts); got != "draft-plan-v2.md" {
+		t.Fatalf("SanitizeSuggestion custom sanitizer = %q; want draft-plan-v2.md", got)
+	}
+	if _, ok := StyleSeparator(StyleCamel); ok {
+		t.Fatal("camel style should have no separator")
+	}
+}
+
+func TestSanitizeCodeName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"v2.1.0 release notes", "v2_1_0_release_notes"},
+		{"api v2.1", "api_v2_1"},
+		{"parseHTTPRequest", "parse_http_request"},
+		{"HTTPServer", "http_server"},
+		{"utf8Decoder", "utf8_decoder"},
+		{"v2Beta", "v2_beta"},
+		{"config -- loader!!", "config_loader"},
+		{"__init__.py", "init_py"},
+		{"already_snake_case", "already_snake_case"},
+		{"first line\nsecond line", "first_line"},
+		{"database_migration_runner_v10_2", "database_migration_runner_v10"},
+		{strings.Repeat("a", 40), strings.Repeat("a", 30)},
+		{"!!!", "file"},
+	}
+	for _, tt := range tests {
+		if got := SanitizeCodeName(tt.raw); got != tt.want {
+			t.Fatalf("SanitizeCodeName(%q) = %q; want %q", tt.raw, got, tt.want)
+		}
+	}
+	if got, _ := ParseStyle(StyleCode); got.Sanitize("parseHTTPRequest") != "parse_http_request" {
+		t.Fatalf("-style code should use SanitizeCodeName")
+	}
+}
@@ -0,0 +1,48 @@
+package naduke
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TrimToLastSentence cuts sample back to the end of its last complete
+// sentence: ".", "!" or "?", with any closing quotes or brackets, followed by
+// whitespace, or a full-width "。", "！" or "？". The cut must keep at least
+// half of sample; otherwise, or when there is no sentence end at all, sample
+// is returned unchanged, so a long first sentence is still sent.
+func TrimToLastSentence(sample string) string {
+	for end := len(sample); end > len(sample)/2; {
+		r, size := utf8.DecodeLastRuneInString(sample[:end])
+		end -= size
+		if cut := sentenceEnd(sample, end, r); cut > len(sample)/2 {
+			return sample[:cut]
+		}
+	}
+	return sample
+}
+
+// sentenceEnd returns the index just past a sentence ending with r at i in
+// text, or 0 when r does not end a sentence there.
+func sentenceEnd(text string, i int, r rune) int {
+	switch r {
+	case '。', '！', '？':
+		return i + utf8.RuneLen(r)
+	case '.', '!', '?':
+	default:
+		return 0
+	}
+	j := i + 1
+	for j < len(text) {
+		next, size := utf8.DecodeRuneInString(text[j:])
+		if !strings.ContainsRune(`"')]”’」』`, next) {
+			break
+		}
+		j += size
+	}
+	next, _ := utf8.DecodeRuneInString(text[j:])
+	if j < len(text) && unicode.IsSpace(next) {
+		return j
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+package naduke
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTrimToLastSentence(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		sample string
+		want   string
+	}{
+		{"mid sentence", "The budget was approved. Hiring starts in May. The new off", "The budget was approved. Hiring starts in May."},
+		{"question and quote", `He asked "why?" Then he left! We wai`, `He asked "why?" Then he left!`},
+		{"full width", "会議は終わりました。次回は来週です。議題は予", "会議は終わりました。次回は来週です。"},
+		{"ends at boundary", "One sentence. Two sentences.", "One sentence. Two sentences."},
+		{"boundary too early", "Hi. This is one very long sentence that goes on without any end in sight", "Hi. This is one very long sentence that goes on without any end in sight"},
+		{"no boundary", "func main() { fmt.Println(version.String) }", "func main() { fmt.Println(version.String) }"},
+		{"decimal", "Version 2.1 ships with the new parser and a fix for the build", "Version 2.1 ships with the new parser and a fix for the build"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TrimToLastSentence(tt.sample); got != tt.want {
+				t.Fatalf("TrimToLastSentence(%q) = %q; want %q", tt.sample, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSampleTrimToSentence(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "essay.txt")
+	text := strings.Repeat("The quarterly report covers sales. ", 40)
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	sample, err := ReadSample(path, Options{TrimAtSentence: true})
+	if err != nil {
+		t.Fatalf("ReadSample error: %v", err)
+	}
+	if !strings.HasSuffix(sample, "covers sales.") || len([]rune(sample)) > readChars {
+		t.Fatalf("sample does not end at a sentence: ...%q", sample[max(0, len(sample)-40):])
+	}
+
+	short := filepath.Join(t.TempDir(), "note.txt")
+	if err := os.WriteFile(short, []byte("Short note. Still going"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if sample, err := ReadSample(short, Options{TrimAtSentence: true}); err != nil || sample != "Short note. Still going" {
+		t.Fatalf("a file that fits should be sent whole: %q, %v", sample, err)
+	}
+}
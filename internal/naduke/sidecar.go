@@ -0,0 +1,55 @@
+package naduke
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SidecarExt is appended to a file's path to name its -sidecar file.
+const SidecarExt = ".naduke"
+
+// SidecarPath returns the sidecar file that records the name suggested for
+// path.
+func SidecarPath(path string) string {
+	return path + SidecarExt
+}
+
+// IsSidecar reports whether path is a sidecar file, which -sidecar runs do
+// not name themselves.
+func IsSidecar(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), SidecarExt)
+}
+
+// WriteSidecar records name, the file name suggested for path, as one line
+// in the sidecar next to path. An earlier sidecar is replaced, so a rerun
+// keeps the latest suggestion; anything else in its place, such as a
+// directory or a symlink, is left alone and reported with
+// ErrDestinationExists. The sidecar is written to a temporary file first, so
+// a reader never sees it half written.
+func WriteSidecar(path, name string) error {
+	sidecar := SidecarPath(path)
+	if info, err := os.Lstat(sidecar); err == nil && !info.Mode().IsRegular() {
+		return fmt.Errorf("%w - %s", ErrDestinationExists, sidecar)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(sidecar), ".naduke-sidecar-*")
+	if err != nil {
+		return fmt.Errorf("write sidecar: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(name + "\n"); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write sidecar: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write sidecar: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("write sidecar: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), sidecar); err != nil {
+		return fmt.Errorf("write sidecar: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package naduke
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteSidecar(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scan001.txt")
+	for _, name := range []string{"first_guess.txt", "meeting_notes.txt"} {
+		if err := WriteSidecar(path, name); err != nil {
+			t.Fatalf("WriteSidecar error: %v", err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "scan001.txt.naduke"))
+	if err != nil {
+		t.Fatalf("read sidecar: %v", err)
+	}
+	if string(data) != "meeting_notes.txt\n" {
+		t.Fatalf("sidecar should hold the latest suggestion, got %q", data)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("temporary files left behind: %v", entries)
+	}
+
+	blocked := filepath.Join(dir, "blocked.txt")
+	if err := os.Mkdir(SidecarPath(blocked), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := WriteSidecar(blocked, "name.txt"); !errors.Is(err, ErrDestinationExists) {
+		t.Fatalf("expected ErrDestinationExists for a directory in the way, got %v", err)
+	}
+
+	if !IsSidecar("a/notes.txt.NADUKE") || IsSidecar("notes.txt") {
+		t.Fatalf("IsSidecar misclassified a path")
+	}
+}
@@ -0,0 +1,84 @@
+package naduke
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+)
+
+// suggestionCache is a bounded, least-recently-used cache of model answers,
+// so a long-lived client names identical content once. It is safe for
+// concurrent use; a nil cache stores nothing.
+type suggestionCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // of *cachedSuggestion, most recently used first
+	items map[string]*list.Element
+}
+
+type cachedSuggestion struct {
+	key  string
+	name string
+}
+
+// newSuggestionCache returns a cache holding up to size answers, or nil when
+// size is not positive.
+func newSuggestionCache(size int) *suggestionCache {
+	if size <= 0 {
+		return nil
+	}
+	return &suggestionCache{size: size, order: list.New(), items: map[string]*list.Element{}}
+}
+
+// suggestionKey identifies a request by everything that shapes the answer:
+// the models tried, the messages, which hold the content, and the sampling
+// options, hashed by opts.HashAlgorithm. It reports false when the request
+// cannot be encoded.
+func suggestionKey(opts Options, models []string, messages []chatMessage) (string, bool) {
+	payload, err := json.Marshal(struct {
+		Models   []string      `json:"models"`
+		Messages []chatMessage `json:"messages"`
+		Options  chatOptions   `json:"options"`
+	}{models, messages, samplingOptions(opts)})
+	if err != nil {
+		return "", false
+	}
+	h := newHash(opts)
+	h.Write(payload)
+	return string(h.Sum(nil)), true
+}
+
+func (c *suggestionCache) get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cachedSuggestion).name, true
+}
+
+// add stores name for key, evicting the least recently used answer when the
+// cache is full.
+func (c *suggestionCache) add(key string, name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*cachedSuggestion).name = name
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.order.PushFront(&cachedSuggestion{key: key, name: name})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cachedSuggestion).key)
+	}
+}
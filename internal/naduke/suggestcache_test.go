@@ -0,0 +1,100 @@
+package naduke
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSuggestionCacheEviction(t *testing.T) {
+	t.Parallel()
+
+	key := func(s string) string { return "key " + s }
+	cache := newSuggestionCache(2)
+	cache.add(key("a"), "alpha")
+	cache.add(key("b"), "beta")
+	if name, ok := cache.get(key("a")); !ok || name != "alpha" {
+		t.Fatalf("get(a) = %q, %v; want alpha", name, ok)
+	}
+	// b is now the least recently used entry.
+	cache.add(key("c"), "gamma")
+	if _, ok := cache.get(key("b")); ok {
+		t.Fatal("b should have been evicted")
+	}
+	for s, want := range map[string]string{"a": "alpha", "c": "gamma"} {
+		if name, ok := cache.get(key(s)); !ok || name != want {
+			t.Fatalf("get(%s) = %q, %v; want %s", s, name, ok, want)
+		}
+	}
+
+	disabled := newSuggestionCache(0)
+	disabled.add(key("a"), "alpha")
+	if _, ok := disabled.get(key("a")); ok {
+		t.Fatal("a disabled cache should not store answers")
+	}
+}
+
+func TestSuggestionCacheConcurrent(t *testing.T) {
+	t.Parallel()
+
+	cache := newSuggestionCache(8)
+	var wg sync.WaitGroup
+	for i := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := fmt.Sprint(i % 10)
+			cache.add(key, "name")
+			cache.get(key)
+		}()
+	}
+	wg.Wait()
+	if cache.order.Len() != len(cache.items) || cache.order.Len() > 8 {
+		t.Fatalf("cache holds %d entries and %d keys; want at most 8", cache.order.Len(), len(cache.items))
+	}
+}
+
+func TestGenerateNameMemoryCache(t *testing.T) {
+	t.Parallel()
+
+	var requests atomic.Int32
+	fakeTransport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"message":{"role":"assistant","content":"meeting_notes"}}`)),
+			Header:     make(http.Header),
+		}, nil
+	})
+	client := &client{
+		http:        &http.Client{Transport: fakeTransport},
+		uri:         &url.URL{Scheme: "http", Host: "example.com", Path: "/api/chat"},
+		suggestions: newSuggestionCache(4),
+	}
+
+	opts := Options{Model: "m"}
+	for range 3 {
+		if name, err := client.GenerateName(opts, "a.txt", "agenda and notes"); err != nil || name != "meeting_notes" {
+			t.Fatalf("GenerateName = %q, %v", name, err)
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("identical requests reached the model %d times; want 1", got)
+	}
+
+	if _, err := client.GenerateName(opts, "b.txt", "other content"); err != nil {
+		t.Fatalf("GenerateName error: %v", err)
+	}
+	opts.Temperature = 0.5
+	if _, err := client.GenerateName(opts, "a.txt", "agenda and notes"); err != nil {
+		t.Fatalf("GenerateName error: %v", err)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Fatalf("new content or options should miss the cache: %d requests; want 3", got)
+	}
+}
@@ -0,0 +1,31 @@
+package naduke
+
+import "net/http"
+
+// DefaultUserAgent identifies naduke to the server when Options.UserAgent is
+// empty. The command sets "naduke/<version>".
+const DefaultUserAgent = "naduke"
+
+// userAgentTransport sets the User-Agent header on every request, so servers
+// and proxies can log or filter naduke's traffic.
+type userAgentTransport struct {
+	next  http.RoundTripper
+	agent string
+}
+
+// newUserAgentTransport wraps next to send opts.UserAgent, or
+// DefaultUserAgent when it is empty.
+func newUserAgentTransport(next http.RoundTripper, opts Options) *userAgentTransport {
+	agent := opts.UserAgent
+	if agent == "" {
+		agent = DefaultUserAgent
+	}
+	return &userAgentTransport{next: next, agent: agent}
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not change the caller's request.
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.agent)
+	return t.next.RoundTrip(req)
+}
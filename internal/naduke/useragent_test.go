@@ -0,0 +1,48 @@
+package naduke
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestUserAgent(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		agent string
+		want  string
+	}{
+		{"default", "", DefaultUserAgent},
+		{"override", "naduke/1.4 (team-docs)", "naduke/1.4 (team-docs)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			fakeTransport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				got = append(got, req.Header.Get("User-Agent"))
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(strings.NewReader(`{"message":{"role":"assistant","content":"meeting_notes"}}`)),
+					Header:     make(http.Header),
+				}, nil
+			})
+			opts := Options{Model: "m", UserAgent: tt.agent}
+			client := &client{
+				http: &http.Client{Transport: newUserAgentTransport(fakeTransport, opts)},
+				uri:  &url.URL{Scheme: "http", Host: "example.com", Path: "/api/chat"},
+			}
+			if _, err := client.GenerateName(opts, "draft.txt", "meeting notes"); err != nil {
+				t.Fatalf("GenerateName error: %v", err)
+			}
+			if len(got) != 1 || got[0] != tt.want {
+				t.Fatalf("User-Agent = %q; want [%q]", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package naduke
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// sinceVersion lists sampling options with the first Ollama version that
+// accepts them. Older servers answer 400 when they see these fields, so they
+// are dropped from requests to them.
+var sinceVersion = []struct {
+	name    string
+	version string
+	isSet   func(chatOptions) bool
+	clear   func(*chatOptions)
+}{
+	{"min_p", "0.1.33", func(o chatOptions) bool { return o.MinP != 0 }, func(o *chatOptions) { o.MinP = 0 }},
+	{"mirostat", "0.1.0", func(o chatOptions) bool { return o.Mirostat != 0 }, func(o *chatOptions) { o.Mirostat = 0 }},
+	{"mirostat_eta", "0.1.0", func(o chatOptions) bool { return o.MirostatEta != 0 }, func(o *chatOptions) { o.MirostatEta = 0 }},
+	{"mirostat_tau", "0.1.0", func(o chatOptions) bool { return o.MirostatTau != 0 }, func(o *chatOptions) { o.MirostatTau = 0 }},
+}
+
+// versionCache holds the server version probed for a client. Only an
+// answer from the server is kept; a probe that failed is tried again on the
+// next request.
+type versionCache struct {
+	mu      sync.Mutex
+	probed  bool
+	version string
+}
+
+type versionResponse struct {
+	Version string `json:"version"`
+}
+
+// serverVersion returns the Ollama version reported by /api/version, probing
+// it on first use. It returns "" when the client does not probe or the server
+// does not say, in which case every option is sent.
+func (c *client) serverVersion() string {
+	if c.version == nil {
+		return ""
+	}
+	c.version.mu.Lock()
+	defer c.version.mu.Unlock()
+	if !c.version.probed {
+		version, ok := c.probeVersion()
+		if !ok {
+			return ""
+		}
+		c.version.version, c.version.probed = version, true
+	}
+	return c.version.version
+}
+
+// probeVersion asks the server for its version. ok is false when there was
+// no usable answer, such as a network error, a canceled request or a server
+// error; a server without /api/version answers "" with ok true.
+func (c *client) probeVersion() (version string, ok bool) {
+	uri := *c.uri
+	uri.Path = "/api/version"
+	req, err := http.NewRequestWithContext(c.context(), http.MethodGet, uri.String(), nil)
+	if err != nil {
+		return "", false
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		slog.Debug("probe server version", "error", err)
+		return "", false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		slog.Debug("probe server version", "status", resp.StatusCode)
+		return "", false
+	}
+	var decoded versionResponse
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&decoded) != nil {
+		slog.Debug("probe server version", "status", resp.StatusCode)
+		return "", true
+	}
+	slog.Debug("server version", "version", decoded.Version)
+	return decoded.Version, true
+}
+
+// dropUnsupported removes the options the server does not accept, both
+// typed fields and matching keys from -options-json. The version is only
+// probed when o sets an option from sinceVersion; an unknown version keeps
+// everything.
+func (c *client) dropUnsupported(o chatOptions) chatOptions {
+	if !usesVersionedOption(o) {
+		return o
+	}
+	return dropUnsupported(o, c.serverVersion())
+}
+
+func usesVersionedOption(o chatOptions) bool {
+	for _, option := range sinceVersion {
+		if _, ok := o.Extra[option.name]; ok || option.isSet(o) {
+			return true
+		}
+	}
+	return false
+}
+
+func dropUnsupported(o chatOptions, version string) chatOptions {
+	if version == "" {
+		return o
+	}
+	extra := o.Extra
+	for _, option := range sinceVersion {
+		_, inExtra := extra[option.name]
+		if !versionBefore(version, option.version) || !inExtra && !option.isSet(o) {
+			continue
+		}
+		option.clear(&o)
+		if inExtra {
+			// Copy rather than delete: the map is shared with opts.
+			copied := make(map[string]any, len(extra))
+			for k, v := range extra {
+				if k != option.name {
+					copied[k] = v
+				}
+			}
+			extra = copied
+		}
+		slog.Debug("drop option unsupported by server", "option", option.name, "version", version)
+	}
+	o.Extra = extra
+	return o
+}
+
+// versionBefore reports whether version a is older than b. Versions compare
+// by their dot-separated numbers; anything after a "-" or "+" is ignored.
+func versionBefore(a, b string) bool {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			return x < y
+		}
+	}
+	return false
+}
+
+func versionParts(version string) []int {
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	var parts []int
+	for _, field := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
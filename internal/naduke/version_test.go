@@ -0,0 +1,148 @@
+package naduke
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGenerateNameOldServerDropsOptions(t *testing.T) {
+	t.Parallel()
+
+	probes := 0
+	var options map[string]any
+	fakeTransport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/api/version" {
+			probes++
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(`{"version":"0.0.19"}`)),
+				Header:     make(http.Header),
+			}, nil
+		}
+		var payload struct {
+			Options map[string]any `json:"options"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		options = payload.Options
+		// Like an old server, reject fields it does not know.
+		for _, field := range []string{"min_p", "mirostat", "mirostat_eta", "mirostat_tau"} {
+			if _, ok := options[field]; ok {
+				return &http.Response{
+					StatusCode: http.StatusBadRequest,
+					Body:       io.NopCloser(strings.NewReader(`{"error":"unknown field ` + field + `"}`)),
+					Header:     make(http.Header),
+				}, nil
+			}
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"message":{"role":"assistant","content":"name"}}`)),
+			Header:     make(http.Header),
+		}, nil
+	})
+
+	client := &client{
+		http:    &http.Client{Transport: fakeTransport},
+		uri:     &url.URL{Scheme: "http", Host: "example.com", Path: "/api/chat"},
+		version: &versionCache{},
+	}
+	opts := Options{
+		Model:        "test-model",
+		Temperature:  0.5,
+		MinP:         0.05,
+		Mirostat:     2,
+		MirostatTau:  5,
+		ExtraOptions: map[string]any{"min_p": 0.1, "num_ctx": 4096},
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := client.GenerateName(opts, "note.txt", "content"); err != nil {
+			t.Fatalf("GenerateName error: %v", err)
+		}
+	}
+	if probes != 1 {
+		t.Fatalf("expected the version to be probed once, got %d", probes)
+	}
+	if options["temperature"] != 0.5 || options["num_ctx"] != float64(4096) {
+		t.Fatalf("supported options should still be sent: %v", options)
+	}
+	if _, ok := opts.ExtraOptions["min_p"]; !ok {
+		t.Fatalf("dropping options must not modify the caller's map")
+	}
+}
+
+func TestServerVersionRetriesFailedProbe(t *testing.T) {
+	t.Parallel()
+
+	probes := 0
+	fakeTransport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		probes++
+		if probes == 1 {
+			return nil, errors.New("connection reset")
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"version":"0.0.19"}`)),
+			Header:     make(http.Header),
+		}, nil
+	})
+	client := &client{
+		http:    &http.Client{Transport: fakeTransport},
+		uri:     &url.URL{Scheme: "http", Host: "example.com", Path: "/api/chat"},
+		version: &versionCache{},
+	}
+
+	if got := client.serverVersion(); got != "" {
+		t.Fatalf("failed probe = %q; want empty", got)
+	}
+	for i := 0; i < 2; i++ {
+		if got := client.serverVersion(); got != "0.0.19" {
+			t.Fatalf("serverVersion = %q; want 0.0.19", got)
+		}
+	}
+	if probes != 2 {
+		t.Fatalf("expected a failed probe to be retried once and the answer kept, got %d probes", probes)
+	}
+}
+
+func TestDropUnsupported(t *testing.T) {
+	t.Parallel()
+
+	opts := chatOptions{MinP: 0.05, Mirostat: 1}
+	if got := dropUnsupported(opts, "0.1.20"); got.MinP != 0 || got.Mirostat != 1 {
+		t.Fatalf("0.1.20 should keep mirostat only: %+v", got)
+	}
+	if got := dropUnsupported(opts, "0.5.7"); got.MinP != 0.05 || got.Mirostat != 1 {
+		t.Fatalf("a current server should keep everything: %+v", got)
+	}
+	if got := dropUnsupported(opts, ""); got.MinP != 0.05 {
+		t.Fatalf("an unknown version should keep everything: %+v", got)
+	}
+}
+
+func TestVersionBefore(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"0.1.32", "0.1.33", true},
+		{"0.1.33", "0.1.33", false},
+		{"0.2", "0.1.33", false},
+		{"v0.1.9", "0.1.10", true},
+		{"0.1.33-rc1", "0.1.33", false},
+		{"0.0.0", "0.1.0", true},
+	}
+	for _, tt := range tests {
+		if got := versionBefore(tt.a, tt.b); got != tt.want {
+			t.Fatalf("versionBefore(%q, %q) = %v; want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package naduke
+
+import (
+	"errors"
+	"log/slog"
+	"path/filepath"
+)
+
+// OriginalXattr is the extended attribute -preserve-original-in-xattr
+// stores the original path in.
+const OriginalXattr = "user.naduke.original"
+
+// errXattrUnsupported is returned by setXattr where the platform has no
+// extended attributes.
+var errXattrUnsupported = errors.New("extended attributes are not supported on this platform")
+
+// recordOriginal stores the absolute path of original in the OriginalXattr
+// attribute of renamed. Failures, such as a filesystem without extended
+// attributes, are only logged as warnings: the rename itself already
+// succeeded.
+func recordOriginal(original, renamed string) {
+	abs, err := filepath.Abs(original)
+	if err != nil {
+		abs = original
+	}
+	if err := setXattr(renamed, OriginalXattr, abs); err != nil {
+		slog.Warn("could not record the original name", "path", renamed, "attribute", OriginalXattr, "error", err)
+	}
+}
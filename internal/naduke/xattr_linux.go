@@ -0,0 +1,22 @@
+package naduke
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func setXattr(path, name, value string) error {
+	if err := syscall.Setxattr(path, name, []byte(value), 0); err != nil {
+		return fmt.Errorf("set %s: %w", name, err)
+	}
+	return nil
+}
+
+func getXattr(path, name string) (string, error) {
+	buf := make([]byte, 4096)
+	n, err := syscall.Getxattr(path, name, buf)
+	if err != nil {
+		return "", fmt.Errorf("get %s: %w", name, err)
+	}
+	return string(buf[:n]), nil
+}
@@ -0,0 +1,46 @@
+package naduke
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenameFilePreservesOriginalInXattr(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	probe := filepath.Join(dir, "probe")
+	if err := os.WriteFile(probe, nil, 0o644); err != nil {
+		t.Fatalf("write probe: %v", err)
+	}
+	if err := setXattr(probe, OriginalXattr, "probe"); err != nil {
+		t.Skipf("extended attributes unavailable: %v", err)
+	}
+
+	src := filepath.Join(dir, "note.txt")
+	if err := os.WriteFile(src, []byte("hello"), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	if err := RenameFile(src, "renamed", Options{PreserveOriginalXattr: true}); err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	got, err := getXattr(filepath.Join(dir, "renamed.txt"), OriginalXattr)
+	if err != nil {
+		t.Fatalf("read attribute: %v", err)
+	}
+	if want, _ := filepath.Abs(src); got != want {
+		t.Fatalf("%s = %q; want %q", OriginalXattr, got, want)
+	}
+
+	plain := filepath.Join(dir, "plain.txt")
+	if err := os.WriteFile(plain, []byte("hello"), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+	if err := RenameFile(plain, "untagged", Options{}); err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	if _, err := getXattr(filepath.Join(dir, "untagged.txt"), OriginalXattr); err == nil {
+		t.Fatalf("attribute set without -preserve-original-in-xattr")
+	}
+}